@@ -4,20 +4,26 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/containerd/containerd/v2/pkg/namespaces"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 	"github.com/terminus-io/Terminus/pkg/exporter"
+	"github.com/terminus-io/Terminus/pkg/gc"
 	"github.com/terminus-io/Terminus/pkg/hooks"
 	"github.com/terminus-io/Terminus/pkg/k8s"
 	"github.com/terminus-io/Terminus/pkg/metadata"
 	"github.com/terminus-io/Terminus/pkg/nri"
+	"github.com/terminus-io/Terminus/pkg/policy"
 	"github.com/terminus-io/Terminus/pkg/reporter"
 	"github.com/terminus-io/Terminus/pkg/utils"
 	"golang.org/x/sync/errgroup"
@@ -53,6 +59,26 @@ var rootCmd = &cobra.Command{
 			kubeletRootPath = "/var/lib/kubelet"
 		}
 
+		enforcementPolicy, err := hooks.ParseEnforcementPolicy(os.Getenv("ENFORCEMENT_POLICY"))
+		if err != nil {
+			return err
+		}
+
+		stateDir := os.Getenv("STATE_PATH")
+		if stateDir == "" {
+			stateDir = "/var/lib/terminus"
+		}
+
+		idRanges, err := projectIDRanges()
+		if err != nil {
+			return err
+		}
+
+		gcInterval, gcSafetyDelay, gcDryRun, err := gcOptions()
+		if err != nil {
+			return err
+		}
+
 		for {
 			containerd := checkContainerdRootPathQuotaEnabled(containerdPath)
 			kubelet := checkContainerdRootPathQuotaEnabled(kubeletRootPath)
@@ -71,6 +97,14 @@ var rootCmd = &cobra.Command{
 			time.Sleep(5 * time.Second)
 		}
 
+		allocator, err := utils.NewProjectIDAllocator(filepath.Join(stateDir, "project-ids.json"), idRanges)
+		if err != nil {
+			return err
+		}
+		if err := allocator.Rebuild(containerdPath, kubeletRootPath); err != nil {
+			return err
+		}
+
 		socket := "/run/containerd/containerd.sock"
 		if _, err := os.Stat(socket); err != nil {
 			log.Fatalf("containerd socket not found: %v", err)
@@ -83,15 +117,37 @@ var rootCmd = &cobra.Command{
 			return err
 		}
 
-		store := metadata.NewAsyncStore(1000, kClient)
+		dynClient, err := k8s.GenrateDynamicClient()
+		if err != nil {
+			return err
+		}
+		policies := policy.NewResolver(kClient, dynClient)
+
+		store, err := metadata.NewAsyncStore(1000, kClient, filepath.Join(stateDir, "soft-limits.json"))
+		if err != nil {
+			return err
+		}
+		recorder := k8s.NewEventRecorder(kClient, "terminus-enforcer")
+		enforcement := hooks.NewEnforcement(enforcementPolicy, recorder)
+		klog.InfoS("Enforcement policy", "policy", enforcementPolicy)
 
 		go func() {
 			store.TriggerRestore()
 		}()
 
+		sharedFilesystem, err := utils.SameFilesystem(containerdPath, kubeletRootPath)
+		if err != nil {
+			return err
+		}
+		if !sharedFilesystem {
+			klog.Warningf("%s and %s are on different filesystems, %s is not supported on this node", containerdPath, kubeletRootPath, hooks.PodSizeAnnotation)
+		}
+
 		containerdWrapper := utils.NewContainerdClientWrapper(socket, "k8s.io")
-		storageHook := hooks.NewStorageHook(store, kClient, containerdPath, containerdWrapper, containerdCtx)
-		emptyStorageHook := hooks.NewEmptyDirHook(store, kClient, kubeletRootPath)
+		storageHook := hooks.NewStorageHook(store, kClient, containerdPath, containerdWrapper, containerdCtx, allocator, enforcement, policies, sharedFilesystem)
+		emptyStorageHook := hooks.NewEmptyDirHook(store, kClient, kubeletRootPath, allocator, enforcement, policies, sharedFilesystem)
+		quotaResizer := hooks.NewQuotaResizer(store, kClient, containerdPath, allocator, recorder)
+		quotaGC := gc.NewQuotaGC(store, allocator, containerdWrapper, containerdCtx, containerdPath, kubeletRootPath, gcInterval, gcSafetyDelay, gcDryRun)
 
 		enforcer, err := nri.NewEnforcer(
 			nri.WithSocketPath(socketPath),
@@ -99,12 +155,15 @@ var rootCmd = &cobra.Command{
 			nri.WithPluginIdx(pluginIdx),
 			nri.WithHook(storageHook),
 			nri.WithHook(emptyStorageHook),
+			nri.WithHook(quotaResizer),
+			nri.WithHook(quotaGC),
 		)
 		if err != nil {
 			return err
 		}
 
 		rpt := reporter.NewReporter(store, kClient, containerdPath, 30*time.Second)
+		softLimitWatcher := reporter.NewSoftLimitWatcher(store, recorder, containerdPath, kubeletRootPath, 30*time.Second)
 
 		ctx, cancel := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
 		defer cancel()
@@ -123,9 +182,33 @@ var rootCmd = &cobra.Command{
 			return nil
 		})
 
+		g.Go(func() error {
+			klog.Info("Starting Soft Limit Watcher...")
+			softLimitWatcher.Run(ctx)
+			return nil
+		})
+
+		g.Go(func() error {
+			klog.Info("Starting Quota Policy Resolver...")
+			policies.Run(ctx)
+			return nil
+		})
+
+		g.Go(func() error {
+			klog.Info("Starting Quota Resizer...")
+			quotaResizer.Run(ctx, os.Getenv("NODE_NAME"))
+			return nil
+		})
+
+		g.Go(func() error {
+			klog.Info("Starting Quota GC...")
+			quotaGC.Run(ctx)
+			return nil
+		})
+
 		g.Go(func() error {
 			collector := exporter.NewStandardCollector(containerdPath, kubeletRootPath, store)
-			return exporter.StartMetricsServer(ctx, store, ":9201", collector)
+			return exporter.StartMetricsServer(ctx, store, ":9201", append([]prometheus.Collector{collector}, gc.Collectors()...)...)
 		})
 
 		g.Go(func() error {
@@ -154,6 +237,67 @@ func init() {
 	_ = flag.Set("logtostderr", "true")
 }
 
+// projectIDRanges 读取各存储类型的 ProjectID 分区，未配置时使用默认值
+func projectIDRanges() (map[metadata.STORAGE_TYPE]utils.IDRange, error) {
+	ranges := make(map[metadata.STORAGE_TYPE]utils.IDRange)
+	for t, r := range utils.DefaultProjectIDRanges {
+		ranges[t] = r
+	}
+
+	envs := map[metadata.STORAGE_TYPE]string{
+		metadata.ROOTFS_TYPE:   "ROOTFS_PROJECT_ID_RANGE",
+		metadata.EMPTYDIR_TYPE: "EMPTYDIR_PROJECT_ID_RANGE",
+		metadata.POD_TYPE:      "POD_PROJECT_ID_RANGE",
+	}
+	for t, env := range envs {
+		if v := os.Getenv(env); v != "" {
+			r, err := utils.ParseIDRange(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", env, err)
+			}
+			ranges[t] = r
+		}
+	}
+	return ranges, nil
+}
+
+// gcOptions 读取孤儿 quota 回收的周期、安全延迟与 dry-run 配置
+func gcOptions() (time.Duration, time.Duration, bool, error) {
+	interval, safetyDelay, dryRun := 5*time.Minute, 10*time.Minute, false
+
+	if v := os.Getenv("GC_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("GC_INTERVAL: %w", err)
+		}
+		if d <= 0 {
+			return 0, 0, false, fmt.Errorf("GC_INTERVAL must be positive, got %s", v)
+		}
+		interval = d
+	}
+
+	if v := os.Getenv("GC_SAFETY_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("GC_SAFETY_DELAY: %w", err)
+		}
+		if d < 0 {
+			return 0, 0, false, fmt.Errorf("GC_SAFETY_DELAY must not be negative, got %s", v)
+		}
+		safetyDelay = d
+	}
+
+	if v := os.Getenv("GC_DRY_RUN"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("GC_DRY_RUN: %w", err)
+		}
+		dryRun = b
+	}
+
+	return interval, safetyDelay, dryRun, nil
+}
+
 func checkContainerdRootPathQuotaEnabled(containerdPath string) bool {
 	data, _ := os.ReadFile("/proc/mounts")
 	for _, line := range strings.Split(string(data), "\n") {
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// optOutAnnotation 为 "false" 时 mutate 不处理该 Pod
+const optOutAnnotation = "storage.terminus.io/inject"
+
+// injectorConfig 为 CONFIG_FILE 指定的配置文件，控制 mutate 的作用范围与行为。validate 不受其影响
+type injectorConfig struct {
+	// IncludeNamespaces 不为空时只处理列出的命名空间
+	IncludeNamespaces []string `json:"includeNamespaces,omitempty"`
+	// ExcludeNamespaces 中的命名空间不处理，优先于其他条件
+	ExcludeNamespaces []string `json:"excludeNamespaces,omitempty"`
+	// NamespaceSelector 按命名空间 label 选择，命名空间缓存未同步时视为不匹配
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// PodSelector 按 Pod label 选择
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// ExcludePodSelector 匹配的 Pod 不处理
+	ExcludePodSelector *metav1.LabelSelector `json:"excludePodSelector,omitempty"`
+
+	// UserAnnotationsWin 为 true 时，用户已写的 storage.terminus.io/size.<container> 不会被 ephemeral-storage 推导的值覆盖
+	UserAnnotationsWin bool `json:"userAnnotationsWin,omitempty"`
+
+	// SchedulerName 不为空时，带有 Terminus 存储限额且未指定调度器的 Pod 会使用该调度器
+	SchedulerName string `json:"schedulerName,omitempty"`
+	// SchedulerExcludeNamespaces 中的命名空间不改写调度器
+	SchedulerExcludeNamespaces []string `json:"schedulerExcludeNamespaces,omitempty"`
+	// SchedulerExcludePodSelector 匹配的 Pod 不改写调度器
+	SchedulerExcludePodSelector *metav1.LabelSelector `json:"schedulerExcludePodSelector,omitempty"`
+
+	// DryRun 为 true 时不修改 Pod，只在审计 annotation 与指标中记录将会注入的内容，也不拒绝违反策略的 Pod
+	DryRun bool `json:"dryRun,omitempty"`
+
+	namespaceSelector  labels.Selector
+	podSelector        labels.Selector
+	excludePodSelector labels.Selector
+
+	schedulerExcludePodSelector labels.Selector
+}
+
+// injectorSettings 为当前生效的配置，未配置文件时为零值，处理所有 Pod
+var injectorSettings atomic.Pointer[injectorConfig]
+
+func init() {
+	injectorSettings.Store(&injectorConfig{})
+}
+
+// currentConfig 返回当前生效的配置
+func currentConfig() *injectorConfig {
+	return injectorSettings.Load()
+}
+
+// parseConfig 解析配置文件并编译其中的 selector
+func parseConfig(data []byte) (*injectorConfig, error) {
+	cfg := &injectorConfig{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, err
+	}
+
+	selectors := []struct {
+		name string
+		in   *metav1.LabelSelector
+		out  *labels.Selector
+	}{
+		{"namespaceSelector", cfg.NamespaceSelector, &cfg.namespaceSelector},
+		{"podSelector", cfg.PodSelector, &cfg.podSelector},
+		{"excludePodSelector", cfg.ExcludePodSelector, &cfg.excludePodSelector},
+		{"schedulerExcludePodSelector", cfg.SchedulerExcludePodSelector, &cfg.schedulerExcludePodSelector},
+	}
+	for _, s := range selectors {
+		if s.in == nil {
+			continue
+		}
+		sel, err := metav1.LabelSelectorAsSelector(s.in)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.name, err)
+		}
+		*s.out = sel
+	}
+
+	return cfg, nil
+}
+
+// selects 判断 mutate 是否应处理该 Pod，返回不处理的原因
+func (c *injectorConfig) selects(pod *corev1.Pod, namespace string) (bool, string) {
+	if pod.Annotations[optOutAnnotation] == "false" {
+		return false, "opted out by annotation"
+	}
+
+	for _, ns := range c.ExcludeNamespaces {
+		if ns == namespace {
+			return false, "namespace excluded"
+		}
+	}
+
+	if len(c.IncludeNamespaces) > 0 {
+		included := false
+		for _, ns := range c.IncludeNamespaces {
+			if ns == namespace {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false, "namespace not included"
+		}
+	}
+
+	if c.namespaceSelector != nil {
+		ns := namespaces.get(namespace)
+		if ns == nil || !c.namespaceSelector.Matches(labels.Set(ns.Labels)) {
+			return false, "namespace not selected"
+		}
+	}
+
+	if c.podSelector != nil && !c.podSelector.Matches(labels.Set(pod.Labels)) {
+		return false, "pod not selected"
+	}
+
+	if c.excludePodSelector != nil && c.excludePodSelector.Matches(labels.Set(pod.Labels)) {
+		return false, "pod excluded"
+	}
+
+	return true, ""
+}
+
+// routeScheduler 为带有 Terminus 存储限额的 Pod 设置 SchedulerName，
+// 已指定其他调度器、已绑定节点或被排除的 Pod 不处理
+func (c *injectorConfig) routeScheduler(pod *corev1.Pod, namespace string) {
+	if c.SchedulerName == "" || pod.Spec.NodeName != "" {
+		return
+	}
+	if pod.Spec.SchedulerName != "" && pod.Spec.SchedulerName != corev1.DefaultSchedulerName {
+		return
+	}
+
+	for _, ns := range c.SchedulerExcludeNamespaces {
+		if ns == namespace {
+			return
+		}
+	}
+	if c.schedulerExcludePodSelector != nil && c.schedulerExcludePodSelector.Matches(labels.Set(pod.Labels)) {
+		return
+	}
+
+	if !hasAnnotationPrefix(pod.Annotations, sizeAnnotation) && !hasAnnotationPrefix(pod.Annotations, podSizeAnnotation) {
+		return
+	}
+
+	pod.Spec.SchedulerName = c.SchedulerName
+}
+
+// configFile 监视配置文件，ConfigMap 更新后内容变化时重新加载
+type configFile struct {
+	path string
+	last []byte
+}
+
+// load 读取配置文件，文件不存在时保持当前配置，解析失败时保留原配置
+func (f *configFile) load() {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	} else if err != nil {
+		klog.ErrorS(err, "Failed to read injector config", "path", f.path)
+		return
+	}
+	if f.last != nil && bytes.Equal(data, f.last) {
+		return
+	}
+	f.last = data
+
+	cfg, err := parseConfig(data)
+	if err != nil {
+		klog.ErrorS(err, "Invalid injector config, keeping the previous one", "path", f.path)
+		return
+	}
+	injectorSettings.Store(cfg)
+	klog.InfoS("Injector config loaded", "path", f.path, "dryRun", cfg.DryRun, "userAnnotationsWin", cfg.UserAnnotationsWin, "schedulerName", cfg.SchedulerName)
+}
+
+// run 每隔 interval 重新加载一次配置，直到 ctx 结束
+func (f *configFile) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.load()
+		}
+	}
+}
+
+// dryRunAnnotation 记录 dry-run 模式下将会注入的内容
+const dryRunAnnotation = "storage.terminus.io/dry-run-injection"
+
+// dryRunRecord 为 dryRunAnnotation 的内容
+type dryRunRecord struct {
+	Annotations        map[string]string `json:"annotations,omitempty"`
+	EmptyDirSizeLimits map[string]string `json:"emptyDirSizeLimits,omitempty"`
+	SchedulerName      string            `json:"schedulerName,omitempty"`
+	Violations         []string          `json:"violations,omitempty"`
+}
+
+// diffPods 比较 mutate 前后的 Pod，返回新增或修改的 annotation 与 emptyDir sizeLimit
+func diffPods(original, mutated *corev1.Pod, violations []string) dryRunRecord {
+	record := dryRunRecord{Violations: violations}
+
+	for k, v := range mutated.Annotations {
+		if ov, ok := original.Annotations[k]; !ok || ov != v {
+			if record.Annotations == nil {
+				record.Annotations = make(map[string]string)
+			}
+			record.Annotations[k] = v
+		}
+	}
+
+	for i, volume := range mutated.Spec.Volumes {
+		if volume.EmptyDir == nil || volume.EmptyDir.SizeLimit == nil || original.Spec.Volumes[i].EmptyDir.SizeLimit != nil {
+			continue
+		}
+		if record.EmptyDirSizeLimits == nil {
+			record.EmptyDirSizeLimits = make(map[string]string)
+		}
+		record.EmptyDirSizeLimits[volume.Name] = volume.EmptyDir.SizeLimit.String()
+	}
+
+	if mutated.Spec.SchedulerName != original.Spec.SchedulerName {
+		record.SchedulerName = mutated.Spec.SchedulerName
+	}
+
+	return record
+}
+
+func (r dryRunRecord) empty() bool {
+	return len(r.Annotations) == 0 && len(r.EmptyDirSizeLimits) == 0 && r.SchedulerName == "" && len(r.Violations) == 0
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "empty", data: ""},
+		{
+			name: "selectors",
+			data: `
+includeNamespaces: [team-a]
+podSelector: {matchExpressions: [{key: app, operator: Exists}]}
+excludePodSelector: {matchLabels: {tier: batch}}
+dryRun: true
+`,
+		},
+		{name: "unknown field", data: "includeNamespace: [team-a]", wantErr: true},
+		{name: "invalid selector operator", data: "podSelector: {matchExpressions: [{key: app, operator: Maybe}]}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfig([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInjectorConfigSelects(t *testing.T) {
+	cfg, err := parseConfig([]byte(`
+includeNamespaces: [team-a, team-b]
+excludeNamespaces: [team-b]
+podSelector: {matchExpressions: [{key: app, operator: Exists}]}
+excludePodSelector: {matchLabels: {tier: batch}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		namespace   string
+		labels      map[string]string
+		annotations map[string]string
+		want        bool
+		wantReason  string
+	}{
+		{name: "selected", namespace: "team-a", labels: map[string]string{"app": "web"}, want: true},
+		{name: "opted out", namespace: "team-a", labels: map[string]string{"app": "web"}, annotations: map[string]string{optOutAnnotation: "false"}, wantReason: "opted out by annotation"},
+		{name: "exclude wins over include", namespace: "team-b", labels: map[string]string{"app": "web"}, wantReason: "namespace excluded"},
+		{name: "namespace not included", namespace: "team-c", labels: map[string]string{"app": "web"}, wantReason: "namespace not included"},
+		{name: "pod not selected", namespace: "team-a", wantReason: "pod not selected"},
+		{name: "pod excluded", namespace: "team-a", labels: map[string]string{"app": "web", "tier": "batch"}, wantReason: "pod excluded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: tt.labels, Annotations: tt.annotations}}
+			got, reason := cfg.selects(pod, tt.namespace)
+			if got != tt.want || reason != tt.wantReason {
+				t.Errorf("selects() = %v, %q, want %v, %q", got, reason, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestInjectorConfigSelectsUnsyncedNamespaces(t *testing.T) {
+	cfg, err := parseConfig([]byte("namespaceSelector: {matchLabels: {terminus.io/inject: enabled}}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, reason := cfg.selects(&corev1.Pod{}, "team-a"); got || reason != "namespace not selected" {
+		t.Errorf("selects() = %v, %q, want the pod skipped until the namespace cache syncs", got, reason)
+	}
+}
+
+func TestDiffPods(t *testing.T) {
+	gi := resource.MustParse("1Gi")
+	pod := func(annotations map[string]string, schedulerName string, sizeLimit *resource.Quantity) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Annotations: annotations},
+			Spec: corev1.PodSpec{
+				SchedulerName: schedulerName,
+				Volumes: []corev1.Volume{
+					{Name: "cache", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{SizeLimit: sizeLimit}}},
+					{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{}}},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		original   *corev1.Pod
+		mutated    *corev1.Pod
+		violations []string
+		want       dryRunRecord
+	}{
+		{
+			name:     "nothing changed",
+			original: pod(map[string]string{"team": "a"}, "", nil),
+			mutated:  pod(map[string]string{"team": "a"}, "", nil),
+		},
+		{
+			name:     "added and changed annotations",
+			original: pod(map[string]string{sizeAnnotation + ".app": "1Gi", "team": "a"}, "", nil),
+			mutated:  pod(map[string]string{sizeAnnotation + ".app": "2Gi", inodeAnnotation: "500k", "team": "a"}, "", nil),
+			want:     dryRunRecord{Annotations: map[string]string{sizeAnnotation + ".app": "2Gi", inodeAnnotation: "500k"}},
+		},
+		{
+			name:     "injected emptyDir sizeLimit",
+			original: pod(nil, "", nil),
+			mutated:  pod(nil, "", &gi),
+			want:     dryRunRecord{EmptyDirSizeLimits: map[string]string{"cache": "1Gi"}},
+		},
+		{
+			name:     "existing emptyDir sizeLimit is not reported",
+			original: pod(nil, "", &gi),
+			mutated:  pod(nil, "", &gi),
+		},
+		{
+			name:       "scheduler routing and violations",
+			original:   pod(nil, "", nil),
+			mutated:    pod(nil, "terminus-scheduler", nil),
+			violations: []string{"too large"},
+			want:       dryRunRecord{SchedulerName: "terminus-scheduler", Violations: []string{"too large"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffPods(tt.original, tt.mutated, tt.violations)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffPods() = %+v, want %+v", got, tt.want)
+			}
+			if got.empty() != reflect.DeepEqual(tt.want, dryRunRecord{}) {
+				t.Errorf("empty() = %v for %+v", got.empty(), got)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/terminus-io/Terminus/pkg/policy"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// emptyDirSizeAnnotation 可写在 Pod 上（.<volume> 或 Pod 级）或命名空间上，为未设置 sizeLimit 的 emptyDir 提供默认值
+	emptyDirSizeAnnotation = "storage.terminus.io/emptydir-size"
+	// injectedEmptyDirAnnotation 记录 webhook 注入的 sizeLimit 及其来源，便于审计
+	injectedEmptyDirAnnotation = "storage.terminus.io/injected-emptydir-sizes"
+)
+
+// sizeLimit 默认值的来源
+const (
+	sourcePodAnnotation       = "pod-annotation"
+	sourceNamespaceAnnotation = "namespace-annotation"
+	sourcePolicy              = "policy"
+	sourceClusterDefault      = "cluster-default"
+)
+
+// defaultEmptyDirSize 为集群级的 emptyDir sizeLimit 默认值，为 nil 时不注入
+var defaultEmptyDirSize *resource.Quantity
+
+// injectedSize 为审计 annotation 中单个卷的记录
+type injectedSize struct {
+	SizeLimit string `json:"sizeLimit"`
+	Source    string `json:"source"`
+}
+
+// applyEmptyDirDefaults 为未设置 sizeLimit 的磁盘型 emptyDir 注入默认值，
+// 优先级为 Pod annotation > 命名空间 annotation > TerminusQuotaPolicy > 集群默认值。
+// 设置了 Pod 级共享限额时不注入，emptyDir 已由共享限额覆盖
+func applyEmptyDirDefaults(pod *corev1.Pod, ns *corev1.Namespace, limits policy.Limits) {
+	if _, shared := pod.Annotations[podSizeAnnotation]; shared {
+		return
+	}
+
+	var nsDefault *resource.Quantity
+	if ns != nil {
+		if v, ok := ns.Annotations[emptyDirSizeAnnotation]; ok {
+			if q, err := resource.ParseQuantity(v); err == nil && q.Sign() > 0 {
+				nsDefault = &q
+			} else {
+				klog.InfoS("Ignoring invalid namespace emptyDir size", "namespace", ns.Name, "annotation", emptyDirSizeAnnotation, "value", v)
+			}
+		}
+	}
+
+	injected := make(map[string]injectedSize)
+	for i := range pod.Spec.Volumes {
+		volume := &pod.Spec.Volumes[i]
+		if volume.EmptyDir == nil || volume.EmptyDir.Medium == corev1.StorageMediumMemory || volume.EmptyDir.SizeLimit != nil {
+			continue
+		}
+
+		var size *resource.Quantity
+		var source string
+		if v, ok := annotationFor(pod.Annotations, emptyDirSizeAnnotation, volume.Name); ok {
+			// 无法解析的值由 validating webhook 拒绝
+			if q, err := resource.ParseQuantity(v); err == nil {
+				size, source = &q, sourcePodAnnotation
+			}
+		}
+		if size == nil && nsDefault != nil {
+			size, source = nsDefault, sourceNamespaceAnnotation
+		}
+		if size == nil && limits.EmptyDir.DefaultSize != nil {
+			size, source = limits.EmptyDir.DefaultSize, sourcePolicy
+		}
+		if size == nil && defaultEmptyDirSize != nil {
+			size, source = defaultEmptyDirSize, sourceClusterDefault
+		}
+		if size == nil {
+			continue
+		}
+
+		limit := size.DeepCopy()
+		volume.EmptyDir.SizeLimit = &limit
+		injected[volume.Name] = injectedSize{SizeLimit: limit.String(), Source: source}
+	}
+
+	if len(injected) == 0 {
+		return
+	}
+	record, err := json.Marshal(injected)
+	if err != nil {
+		klog.ErrorS(err, "Failed to record injected emptyDir sizes", "namespace", pod.Namespace, "pod", podName(pod))
+		return
+	}
+	pod.Annotations[injectedEmptyDirAnnotation] = string(record)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// 可注入限额的容器类型
+const (
+	kindContainers          = "containers"
+	kindInitContainers      = "initContainers"
+	kindSidecars            = "sidecars"
+	kindEphemeralContainers = "ephemeralContainers"
+)
+
+// injectOptions 控制 mutate 覆盖哪些容器以及如何从 ephemeral-storage 推导限额
+type injectOptions struct {
+	// kinds 为需要注入的容器类型，sidecars 指 restartPolicy 为 Always 的 init 容器
+	kinds map[string]bool
+	// requestsFallback 为 true 时，未设置 limit 的容器使用 request 乘以 requestMultiplier
+	requestsFallback  bool
+	requestMultiplier float64
+	// ephemeralSize 为临时容器的默认限额，临时容器不允许声明 resources，为空时使用策略默认值
+	ephemeralSize *resource.Quantity
+}
+
+// loadInjectOptions 从环境变量读取注入配置，未配置时只覆盖普通容器的 limit
+func loadInjectOptions() (injectOptions, error) {
+	opts := injectOptions{
+		kinds:             map[string]bool{kindContainers: true},
+		requestMultiplier: 1,
+	}
+
+	if v := os.Getenv("INJECT_CONTAINER_KINDS"); v != "" {
+		opts.kinds = make(map[string]bool)
+		for _, kind := range strings.Split(v, ",") {
+			kind = strings.TrimSpace(kind)
+			switch kind {
+			case kindContainers, kindInitContainers, kindSidecars, kindEphemeralContainers:
+				opts.kinds[kind] = true
+			case "":
+			default:
+				return opts, fmt.Errorf("INJECT_CONTAINER_KINDS: unknown container kind %q", kind)
+			}
+		}
+	}
+
+	if v := os.Getenv("REQUESTS_FALLBACK"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("REQUESTS_FALLBACK: %w", err)
+		}
+		opts.requestsFallback = b
+	}
+
+	if v := os.Getenv("REQUEST_MULTIPLIER"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 1 {
+			return opts, fmt.Errorf("REQUEST_MULTIPLIER: %q must be a number not less than 1", v)
+		}
+		opts.requestMultiplier = f
+	}
+
+	if v := os.Getenv("EPHEMERAL_CONTAINER_SIZE"); v != "" {
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			return opts, fmt.Errorf("EPHEMERAL_CONTAINER_SIZE: %w", err)
+		}
+		opts.ephemeralSize = &q
+	}
+
+	return opts, nil
+}
+
+// coveredContainers 返回配置中需要注入限额的普通容器、init 容器与 sidecar
+func (o injectOptions) coveredContainers(pod *corev1.Pod) []corev1.Container {
+	var containers []corev1.Container
+	if o.kinds[kindContainers] {
+		containers = append(containers, pod.Spec.Containers...)
+	}
+	for _, c := range pod.Spec.InitContainers {
+		sidecar := c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways
+		if (sidecar && o.kinds[kindSidecars]) || (!sidecar && o.kinds[kindInitContainers]) {
+			containers = append(containers, c)
+		}
+	}
+	return containers
+}
+
+// containerLimit 返回容器的 ephemeral-storage 限额，开启回退时未设置 limit 的容器按 request 乘以倍数计算
+func (o injectOptions) containerLimit(container corev1.Container) (string, bool) {
+	if limit, ok := container.Resources.Limits[corev1.ResourceEphemeralStorage]; ok && !limit.IsZero() {
+		return limit.String(), true
+	}
+
+	if !o.requestsFallback {
+		return "", false
+	}
+	request, ok := container.Resources.Requests[corev1.ResourceEphemeralStorage]
+	if !ok || request.IsZero() {
+		return "", false
+	}
+	if o.requestMultiplier == 1 {
+		return request.String(), true
+	}
+	scaled := int64(math.Ceil(float64(request.Value()) * o.requestMultiplier))
+	return resource.NewQuantity(scaled, resource.BinarySI).String(), true
+}
+
+// ephemeralContainerSize 返回写入 Pod 的临时容器默认限额。临时容器在 Pod 创建后通过 pods/ephemeralcontainers 加入，
+// 子资源的更新会丢弃 metadata 的修改，因此在创建时写入 ephemeral-size，由 enforcer 在创建临时容器时读取
+func (o injectOptions) ephemeralContainerSize(pod *corev1.Pod, defaultSize *resource.Quantity) (string, bool) {
+	if !o.kinds[kindEphemeralContainers] {
+		return "", false
+	}
+
+	// Pod 级共享限额或默认限额已覆盖临时容器
+	if hasAnyKey(pod.Annotations, podSizeAnnotation, sizeAnnotation) {
+		return "", false
+	}
+
+	size := o.ephemeralSize
+	if size == nil {
+		size = defaultSize
+	}
+	if size == nil {
+		return "", false
+	}
+	return size.String(), true
+}
+
+func hasAnyKey(m map[string]string, keys ...string) bool {
+	for _, k := range keys {
+		if _, ok := m[k]; ok {
+			return true
+		}
+	}
+	return false
+}
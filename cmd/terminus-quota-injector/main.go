@@ -3,26 +3,62 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"flag"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mattbaird/jsonpatch"
+	"github.com/terminus-io/Terminus/pkg/budget"
+	"github.com/terminus-io/Terminus/pkg/k8s"
+	"github.com/terminus-io/Terminus/pkg/policy"
 	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
 )
 
 var (
 	runtimeScheme = runtime.NewScheme()
 	codecs        = serializer.NewCodecFactory(runtimeScheme)
 	deserializer  = codecs.UniversalDeserializer()
+
+	// defaultInodes 为带有磁盘限额但未声明 inode 限额的 Pod 注入的默认值，为空时不注入
+	defaultInodes string
+
+	// policies 为 nil 或未同步时不应用 TerminusQuotaPolicy
+	policies *policy.Resolver
+
+	// budgets 为 nil 或未同步时不检查 TerminusStorageBudget
+	budgets *budget.Tracker
+
+	// injection 控制 mutate 覆盖的容器类型与 request 回退
+	injection injectOptions
+
+	// kubeClient 用于自管理 webhook 证书，为 nil 时无法自签证书
+	kubeClient kubernetes.Interface
+
+	// enforcerUsername 为唯一允许修改 project-id annotation 与 quota label 的用户
+	enforcerUsername = "system:serviceaccount:terminus:terminus-admin"
+)
+
+const (
+	sizeAnnotation          = "storage.terminus.io/size"
+	inodeAnnotation         = "storage.terminus.io/inodes"
+	podSizeAnnotation       = "storage.terminus.io/pod-size"
+	emptyDirInodeAnnotation = "emptydir.terminus.io/inodes"
+	ephemeralSizeAnnotation = "storage.terminus.io/ephemeral-size"
 )
 
 func init() {
@@ -31,18 +67,111 @@ func init() {
 }
 
 func main() {
-	r := gin.Default()
-	r.POST("/mutate", mutateHandler)
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	if v := os.Getenv("DEFAULT_INODES"); v != "" {
+		if _, err := resource.ParseQuantity(v); err != nil {
+			exit(err, "Invalid DEFAULT_INODES", "value", v)
+		}
+		defaultInodes = v
+	}
+
+	if v := os.Getenv("MAX_QUOTA_SIZE"); v != "" {
+		q, err := resource.ParseQuantity(v)
+		if err != nil || q.Sign() <= 0 {
+			exit(err, "Invalid MAX_QUOTA_SIZE", "value", v)
+		}
+		maxQuotaSize = q
+	}
+
+	if v := os.Getenv("MAX_QUOTA_INODES"); v != "" {
+		q, err := resource.ParseQuantity(v)
+		if err != nil || q.Sign() <= 0 {
+			exit(err, "Invalid MAX_QUOTA_INODES", "value", v)
+		}
+		maxQuotaInodes = q
+	}
+
+	if v := os.Getenv("ENFORCER_SERVICE_ACCOUNT"); v != "" {
+		parts := strings.Split(v, ":")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			exit(nil, "Invalid ENFORCER_SERVICE_ACCOUNT, expected <namespace>:<name>", "value", v)
+		}
+		enforcerUsername = "system:serviceaccount:" + v
+	}
+
+	config := &configFile{path: envOr("CONFIG_FILE", "/etc/terminus-injector/config.yaml")}
+	config.load()
+
+	opts, err := loadInjectOptions()
+	if err != nil {
+		exit(err, "Invalid injection options")
+	}
+	injection = opts
+
+	if v := os.Getenv("DEFAULT_EMPTYDIR_SIZE"); v != "" {
+		q, err := resource.ParseQuantity(v)
+		if err != nil || q.Sign() <= 0 {
+			exit(err, "Invalid DEFAULT_EMPTYDIR_SIZE", "value", v)
+		}
+		defaultEmptyDirSize = &q
+	}
+
+	policyCtx, stopPolicies := context.WithCancel(context.Background())
+	defer stopPolicies()
+	if kClient, err := k8s.GenrateK8sClient(); err != nil {
+		klog.ErrorS(err, "Kubernetes client unavailable, quota policies disabled")
+	} else if dynClient, err := k8s.GenrateDynamicClient(); err != nil {
+		klog.ErrorS(err, "Dynamic client unavailable, quota policies disabled")
+	} else {
+		kubeClient = kClient
+		go namespaces.run(policyCtx, kClient)
+
+		policies = policy.NewResolver(kClient, dynClient)
+		go policies.Run(policyCtx)
+
+		budgets = budget.NewTracker(kClient, dynClient, 30*time.Second)
+		go budgets.Run(policyCtx)
+	}
+
+	health := newHealthServer(envOr("HEALTH_ADDR", ":8080"))
+	go func() {
+		klog.InfoS("Health and metrics server listening", "addr", health.Addr)
+		if err := health.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			exit(err, "Health server failed to start")
+		}
+	}()
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.POST("/mutate", observeAdmission("mutate"), mutateHandler)
+	r.POST("/validate", observeAdmission("validate"), validateHandler)
+
+	go config.run(policyCtx, 10*time.Second)
+
+	tlsConfig, err := setupTLS(policyCtx)
+	if err != nil {
+		exit(err, "Failed to set up webhook TLS")
+	}
 
 	srv := &http.Server{
-		Addr:    ":8443",
-		Handler: r,
+		Addr:      ":8443",
+		Handler:   r,
+		TLSConfig: tlsConfig,
 	}
 
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		exit(err, "Webhook failed to listen", "addr", srv.Addr)
+	}
+	ready.Store(true)
+
 	go func() {
-		log.Println("Gin mutating webhook listening on :8443")
-		if err := srv.ListenAndServeTLS("/etc/webhook/certs/tls.crt", "/etc/webhook/certs/tls.key"); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Webhook failed to start: %s\n", err)
+		klog.InfoS("Admission webhook listening", "addr", srv.Addr)
+		if err := srv.ServeTLS(ln, "", ""); err != nil && err != http.ErrServerClosed {
+			exit(err, "Webhook failed to start")
 		}
 	}()
 
@@ -51,33 +180,43 @@ func main() {
 
 	<-quit
 
-	log.Println("Received termination signal, shutting down webhook service gracefully...")
+	klog.Info("Received termination signal, shutting down webhook service gracefully...")
+	ready.Store(false)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Webhook service forced shutdown error: ", err)
+		klog.ErrorS(err, "Webhook service forced shutdown")
 	}
+	_ = health.Shutdown(ctx)
 
-	log.Println("Webhook service successfully stopped!")
+	klog.Info("Webhook service successfully stopped")
+	klog.Flush()
+}
+
+// exit 记录错误并退出进程
+func exit(err error, msg string, keysAndValues ...interface{}) {
+	klog.ErrorS(err, msg, keysAndValues...)
+	klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 }
 
 func mutateHandler(c *gin.Context) {
 	var review admissionv1.AdmissionReview
 	if err := c.ShouldBindJSON(&review); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid admission review"})
+		fail(c, http.StatusBadRequest, reasonDecode, "invalid admission review", err)
 		return
 	}
 
 	if review.Request == nil || review.Request.Object.Raw == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no object in request"})
+		fail(c, http.StatusBadRequest, reasonDecode, "no object in request", nil)
 		return
 	}
+	c.Set(operationKey, string(review.Request.Operation))
 
 	pod := &corev1.Pod{}
 	if err := json.Unmarshal(review.Request.Object.Raw, pod); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "unmarshal pod failed"})
+		fail(c, http.StatusBadRequest, reasonDecode, "unmarshal pod failed", err)
 		return
 	}
 
@@ -85,31 +224,88 @@ func mutateHandler(c *gin.Context) {
 		pod.Annotations = make(map[string]string)
 	}
 
-	for i := range pod.Spec.Containers {
-		container := &pod.Spec.Containers[i]
-		if limit, ok := container.Resources.Limits[corev1.ResourceEphemeralStorage]; ok && limit.String() != "" {
-			key := "storage.terminus.io/size." + container.Name
-			pod.Annotations[key] = limit.String()
+	namespace := pod.Namespace
+	if namespace == "" {
+		namespace = review.Request.Namespace
+	}
+
+	cfg := currentConfig()
+	if selected, reason := cfg.selects(pod, namespace); !selected {
+		skippedPods.WithLabelValues(reason).Inc()
+		klog.V(4).InfoS("Pod skipped by injector config", "namespace", namespace, "pod", podName(pod), "reason", reason)
+		respond(c, allowReview(review.Request.UID))
+		return
+	}
+
+	limits := policies.Resolve(namespace, pod.Labels)
+
+	// 临时容器的限额由创建时写入的 ephemeral-size 决定，子资源更新无需处理。
+	// 旧版本的 webhook 配置仍会转发 pods/ephemeralcontainers，直接放行
+	if review.Request.SubResource != "" {
+		respond(c, allowReview(review.Request.UID))
+		return
+	}
+
+	original := pod.DeepCopy()
+
+	containers := injection.coveredContainers(pod)
+	for _, container := range containers {
+		key := sizeAnnotation + "." + container.Name
+		if _, exists := pod.Annotations[key]; exists && cfg.UserAnnotationsWin {
+			continue
+		}
+		if limit, ok := injection.containerLimit(container); ok {
+			pod.Annotations[key] = limit
+		}
+	}
+
+	applyPolicyDefaults(pod, containers, limits)
+	applyEmptyDirDefaults(pod, namespaces.get(namespace), limits)
+
+	if size, ok := injection.ephemeralContainerSize(pod, limits.Rootfs.DefaultSize); ok {
+		if _, exists := pod.Annotations[ephemeralSizeAnnotation]; !exists || !cfg.UserAnnotationsWin {
+			pod.Annotations[ephemeralSizeAnnotation] = size
 		}
 	}
 
+	if defaultInodes != "" && hasAnnotationPrefix(pod.Annotations, sizeAnnotation) && !hasAnnotationPrefix(pod.Annotations, inodeAnnotation) {
+		pod.Annotations[inodeAnnotation] = defaultInodes
+	}
+
+	cfg.routeScheduler(pod, namespace)
+
+	violations := policyViolations(pod, limits)
+	if len(violations) > 0 && !cfg.DryRun {
+		klog.V(2).InfoS("Pod denied by quota policy", "namespace", namespace, "pod", podName(pod), "violations", violations)
+		respond(c, denyReview(review.Request.UID, strings.Join(violations, "; ")))
+		return
+	}
+
+	if cfg.DryRun {
+		pod = dryRun(original, pod, namespace, violations)
+	} else if record := diffPods(original, pod, nil); len(record.Annotations) > 0 {
+		injectedAnnotations.WithLabelValues(namespace).Add(float64(len(record.Annotations)))
+	}
+
 	modifiedPodBytes, err := json.Marshal(pod)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "marshal patched pod failed"})
+		fail(c, http.StatusInternalServerError, reasonPatch, "marshal patched pod failed", err)
 		return
 	}
 
 	patch, err := jsonpatch.CreatePatch(review.Request.Object.Raw, modifiedPodBytes)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "create patch failed"})
+		fail(c, http.StatusInternalServerError, reasonPatch, "create patch failed", err)
 		return
 	}
 
 	jsonPatchBytes, err := json.Marshal(patch)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "marshal json patch failed"})
+		fail(c, http.StatusInternalServerError, reasonPatch, "marshal json patch failed", err)
 		return
 	}
+	patchSize.Observe(float64(len(jsonPatchBytes)))
+	klog.V(4).InfoS("Pod mutated", "namespace", namespace, "pod", podName(pod), "operations", len(patch))
 
 	resp := admissionv1.AdmissionReview{
 		TypeMeta: metav1.TypeMeta{
@@ -127,5 +323,212 @@ func mutateHandler(c *gin.Context) {
 		},
 	}
 
-	c.JSON(http.StatusOK, resp)
+	respond(c, resp)
+}
+
+// validateHandler 在 mutate 之后执行，拒绝伪造受保护 key、格式错误的 annotation 以及超出命名空间 TerminusStorageBudget 的 Pod
+func validateHandler(c *gin.Context) {
+	var review admissionv1.AdmissionReview
+	if err := c.ShouldBindJSON(&review); err != nil {
+		fail(c, http.StatusBadRequest, reasonDecode, "invalid admission review", err)
+		return
+	}
+
+	if review.Request == nil || review.Request.Object.Raw == nil {
+		fail(c, http.StatusBadRequest, reasonDecode, "no object in request", nil)
+		return
+	}
+	c.Set(operationKey, string(review.Request.Operation))
+
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(review.Request.Object.Raw, pod); err != nil {
+		fail(c, http.StatusBadRequest, reasonDecode, "unmarshal pod failed", err)
+		return
+	}
+
+	var oldPod *corev1.Pod
+	if review.Request.Operation == admissionv1.Update && review.Request.OldObject.Raw != nil {
+		oldPod = &corev1.Pod{}
+		if err := json.Unmarshal(review.Request.OldObject.Raw, oldPod); err != nil {
+			fail(c, http.StatusBadRequest, reasonDecode, "unmarshal old pod failed", err)
+			return
+		}
+	}
+
+	var violations []string
+	if review.Request.UserInfo.Username != enforcerUsername {
+		violations = append(violations, protectedKeyViolations(pod, oldPod)...)
+	}
+	violations = append(violations, malformedAnnotations(pod, oldPod)...)
+	if len(violations) > 0 {
+		klog.InfoS("Rejected pod with invalid Terminus annotations", "namespace", review.Request.Namespace, "pod", review.Request.Name, "user", review.Request.UserInfo.Username, "violations", violations)
+		respond(c, denyReview(review.Request.UID, strings.Join(violations, "; ")))
+		return
+	}
+
+	if err := budgets.Check(review.Request.Namespace, pod, oldPod); err != nil {
+		klog.V(2).InfoS("Pod denied by storage budget", "namespace", review.Request.Namespace, "pod", review.Request.Name, "err", err)
+		respond(c, denyReview(review.Request.UID, err.Error()))
+		return
+	}
+
+	respond(c, allowReview(review.Request.UID))
+}
+
+// dryRun 返回只带有审计 annotation 的原始 Pod，并记录将会注入的内容
+func dryRun(original, mutated *corev1.Pod, namespace string, violations []string) *corev1.Pod {
+	record := diffPods(original, mutated, violations)
+	if record.empty() {
+		return original
+	}
+
+	dryRunPods.WithLabelValues(namespace).Inc()
+	dryRunAnnotations.WithLabelValues(namespace).Add(float64(len(record.Annotations) + len(record.EmptyDirSizeLimits)))
+	if len(violations) > 0 {
+		dryRunDenials.WithLabelValues(namespace).Inc()
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		klog.ErrorS(err, "Failed to record dry run", "namespace", namespace, "pod", podName(original))
+		return original
+	}
+
+	pod := original.DeepCopy()
+	pod.Annotations[dryRunAnnotation] = string(data)
+	return pod
+}
+
+// allowReview 返回不修改 Pod 的放行 AdmissionReview
+func allowReview(uid types.UID) admissionv1.AdmissionReview {
+	return admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "AdmissionReview",
+			APIVersion: "admission.k8s.io/v1",
+		},
+		Response: &admissionv1.AdmissionResponse{
+			UID:     uid,
+			Allowed: true,
+		},
+	}
+}
+
+// denyReview 返回拒绝 Pod 的 AdmissionReview
+func denyReview(uid types.UID, message string) admissionv1.AdmissionReview {
+	return admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "AdmissionReview",
+			APIVersion: "admission.k8s.io/v1",
+		},
+		Response: &admissionv1.AdmissionResponse{
+			UID:     uid,
+			Allowed: false,
+			Result: &metav1.Status{
+				Code:    http.StatusForbidden,
+				Reason:  metav1.StatusReasonForbidden,
+				Message: message,
+			},
+		},
+	}
+}
+
+// applyPolicyDefaults 为未声明限额的容器注入 TerminusQuotaPolicy 中的默认值，emptyDir 的 sizeLimit 由 applyEmptyDirDefaults 处理
+func applyPolicyDefaults(pod *corev1.Pod, containers []corev1.Container, limits policy.Limits) {
+	_, shared := pod.Annotations[podSizeAnnotation]
+	_, podSize := pod.Annotations[sizeAnnotation]
+
+	if limits.Rootfs.DefaultSize != nil && !shared && !podSize {
+		for _, container := range containers {
+			key := sizeAnnotation + "." + container.Name
+			if _, ok := pod.Annotations[key]; !ok {
+				pod.Annotations[key] = limits.Rootfs.DefaultSize.String()
+			}
+		}
+	}
+
+	if limits.Rootfs.DefaultInodes != nil && !hasAnnotationPrefix(pod.Annotations, inodeAnnotation) {
+		pod.Annotations[inodeAnnotation] = limits.Rootfs.DefaultInodes.String()
+	}
+
+	for i := range pod.Spec.Volumes {
+		volume := &pod.Spec.Volumes[i]
+		if volume.EmptyDir == nil || volume.EmptyDir.Medium == corev1.StorageMediumMemory {
+			continue
+		}
+
+		if limits.EmptyDir.DefaultInodes != nil {
+			if _, ok := annotationFor(pod.Annotations, emptyDirInodeAnnotation, volume.Name); !ok {
+				pod.Annotations[emptyDirInodeAnnotation+"."+volume.Name] = limits.EmptyDir.DefaultInodes.String()
+			}
+		}
+	}
+}
+
+// policyViolations 返回超过 TerminusQuotaPolicy 上限的限额声明，无法解析的值由 enforcer 处理
+func policyViolations(pod *corev1.Pod, limits policy.Limits) []string {
+	var violations []string
+
+	exceeds := func(value string, max *resource.Quantity) bool {
+		if max == nil {
+			return false
+		}
+		q, err := resource.ParseQuantity(value)
+		return err == nil && q.Cmp(*max) > 0
+	}
+
+	for _, container := range append(pod.Spec.Containers, pod.Spec.InitContainers...) {
+		if v, ok := annotationFor(pod.Annotations, sizeAnnotation, container.Name); ok && exceeds(v, limits.Rootfs.MaxSize) {
+			violations = append(violations, fmt.Sprintf("container %s rootfs size %s exceeds policy maximum %s", container.Name, v, limits.Rootfs.MaxSize.String()))
+		}
+		if v, ok := annotationFor(pod.Annotations, inodeAnnotation, container.Name); ok && exceeds(v, limits.Rootfs.MaxInodes) {
+			violations = append(violations, fmt.Sprintf("container %s inode limit %s exceeds policy maximum %s", container.Name, v, limits.Rootfs.MaxInodes.String()))
+		}
+	}
+
+	diskEmptyDirs := 0
+	for _, volume := range pod.Spec.Volumes {
+		if volume.EmptyDir == nil || volume.EmptyDir.Medium == corev1.StorageMediumMemory {
+			continue
+		}
+		diskEmptyDirs++
+
+		if volume.EmptyDir.SizeLimit != nil && exceeds(volume.EmptyDir.SizeLimit.String(), limits.EmptyDir.MaxSize) {
+			violations = append(violations, fmt.Sprintf("emptyDir %s sizeLimit %s exceeds policy maximum %s", volume.Name, volume.EmptyDir.SizeLimit.String(), limits.EmptyDir.MaxSize.String()))
+		}
+		if v, ok := annotationFor(pod.Annotations, emptyDirInodeAnnotation, volume.Name); ok && exceeds(v, limits.EmptyDir.MaxInodes) {
+			violations = append(violations, fmt.Sprintf("emptyDir %s inode limit %s exceeds policy maximum %s", volume.Name, v, limits.EmptyDir.MaxInodes.String()))
+		}
+	}
+
+	// Pod 级共享限额不能超过各容器与 emptyDir 上限之和
+	if v, ok := pod.Annotations[podSizeAnnotation]; ok && limits.Rootfs.MaxSize != nil && (diskEmptyDirs == 0 || limits.EmptyDir.MaxSize != nil) {
+		max := resource.NewQuantity(limits.Rootfs.MaxSize.Value()*int64(len(pod.Spec.Containers)), resource.BinarySI)
+		if diskEmptyDirs > 0 {
+			max.Add(*resource.NewQuantity(limits.EmptyDir.MaxSize.Value()*int64(diskEmptyDirs), resource.BinarySI))
+		}
+		if exceeds(v, max) {
+			violations = append(violations, fmt.Sprintf("pod size %s exceeds policy maximum %s", v, max.String()))
+		}
+	}
+
+	return violations
+}
+
+// annotationFor 先查找 key.<name>，不存在时回退到 Pod 级的 key
+func annotationFor(annotations map[string]string, key, name string) (string, bool) {
+	if v, ok := annotations[key+"."+name]; ok {
+		return v, true
+	}
+	v, ok := annotations[key]
+	return v, ok
+}
+
+// hasAnnotationPrefix 判断是否存在 key 或 key.<name> 形式的 annotation
+func hasAnnotationPrefix(annotations map[string]string, key string) bool {
+	for k := range annotations {
+		if k == key || strings.HasPrefix(k, key+".") {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// gin.Context 中记录单次准入请求信息的 key
+const (
+	webhookKey   = "terminus.webhook"
+	operationKey = "terminus.operation"
+	resultKey    = "terminus.result"
+)
+
+// 准入请求的结果与错误原因
+const (
+	resultAllowed = "allowed"
+	resultDenied  = "denied"
+	resultError   = "error"
+
+	reasonDecode = "decode"
+	// reasonPatch 为生成 patch 失败，webhook 的 failurePolicy 为 Ignore，Pod 会在没有限额的情况下创建
+	reasonPatch = "patch"
+)
+
+var (
+	admissionRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "terminus_injector_admission_requests_total",
+		Help: "Admission requests handled by the quota injector",
+	}, []string{"webhook", "operation", "result"})
+	admissionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "terminus_injector_admission_duration_seconds",
+		Help:    "Time spent handling an admission request",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"webhook"})
+	admissionErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "terminus_injector_admission_errors_total",
+		Help: "Admission requests that failed; with failurePolicy Ignore the pod is admitted without quota",
+	}, []string{"webhook", "reason"})
+	patchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "terminus_injector_patch_size_bytes",
+		Help:    "Size of the JSON patch returned by the mutating webhook",
+		Buckets: prometheus.ExponentialBuckets(64, 2, 12),
+	})
+	injectedAnnotations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "terminus_injector_injected_annotations_total",
+		Help: "Annotations added or changed by the mutating webhook",
+	}, []string{"namespace"})
+
+	skippedPods = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "terminus_injector_skipped_pods_total",
+		Help: "Pods the mutating webhook left untouched because of the injector config",
+	}, []string{"reason"})
+	dryRunPods = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "terminus_injector_dry_run_pods_total",
+		Help: "Pods that would have been mutated if dry-run were disabled",
+	}, []string{"namespace"})
+	dryRunAnnotations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "terminus_injector_dry_run_annotations_total",
+		Help: "Annotations and emptyDir size limits that would have been injected in dry-run mode",
+	}, []string{"namespace"})
+	dryRunDenials = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "terminus_injector_dry_run_denials_total",
+		Help: "Pods that would have been denied for exceeding quota policy limits in dry-run mode",
+	}, []string{"namespace"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		admissionRequests, admissionDuration, admissionErrors, patchSize, injectedAnnotations,
+		skippedPods, dryRunPods, dryRunAnnotations, dryRunDenials,
+	)
+}
+
+// observeAdmission 记录准入请求的数量、结果与耗时
+func observeAdmission(webhook string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(webhookKey, webhook)
+		start := time.Now()
+
+		c.Next()
+
+		operation := c.GetString(operationKey)
+		if operation == "" {
+			operation = "unknown"
+		}
+		result := c.GetString(resultKey)
+		if result == "" {
+			result = resultError
+		}
+
+		elapsed := time.Since(start)
+		admissionRequests.WithLabelValues(webhook, operation, result).Inc()
+		admissionDuration.WithLabelValues(webhook).Observe(elapsed.Seconds())
+		klog.V(5).InfoS("Admission request handled", "webhook", webhook, "operation", operation, "result", result, "duration", elapsed)
+	}
+}
+
+// respond 写回 AdmissionReview 并记录结果
+func respond(c *gin.Context, review admissionv1.AdmissionReview) {
+	result := resultAllowed
+	if review.Response != nil && !review.Response.Allowed {
+		result = resultDenied
+	}
+	c.Set(resultKey, result)
+	c.JSON(http.StatusOK, review)
+}
+
+// fail 记录错误并返回错误响应，apiserver 会按 webhook 的 failurePolicy 处理
+func fail(c *gin.Context, status int, reason, message string, err error) {
+	webhook := c.GetString(webhookKey)
+	c.Set(resultKey, resultError)
+	admissionErrors.WithLabelValues(webhook, reason).Inc()
+	klog.ErrorS(err, "Admission request failed", "webhook", webhook, "reason", reason, "message", message)
+	c.JSON(status, gin.H{"error": message})
+}
+
+// podName 返回 Pod 名称，创建时名称可能尚未生成，使用 generateName
+func podName(pod *corev1.Pod) string {
+	if pod.Name != "" {
+		return pod.Name
+	}
+	return pod.GenerateName
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// namespaceCache 缓存命名空间，用于读取命名空间级的 annotation 与 label
+type namespaceCache struct {
+	lister corelisters.NamespaceLister
+	synced atomic.Bool
+}
+
+var namespaces = &namespaceCache{}
+
+// run 启动命名空间 informer，直到 ctx 结束
+func (n *namespaceCache) run(ctx context.Context, kClient kubernetes.Interface) {
+	factory := informers.NewSharedInformerFactory(kClient, 0)
+	informer := factory.Core().V1().Namespaces()
+	n.lister = informer.Lister()
+	informer.Informer()
+
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		return
+	}
+	n.synced.Store(true)
+	klog.Info("Namespace cache synced")
+
+	<-ctx.Done()
+}
+
+// get 返回命名空间，缓存未同步或不存在时返回 nil
+func (n *namespaceCache) get(name string) *corev1.Namespace {
+	if !n.synced.Load() {
+		return nil
+	}
+	ns, err := n.lister.Get(name)
+	if err != nil {
+		return nil
+	}
+	return ns
+}
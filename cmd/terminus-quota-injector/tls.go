@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/terminus-io/Terminus/pkg/certs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// setupTLS 返回 webhook 使用的 tls.Config。SELF_MANAGED_CERTS 为 true 时由 injector 自行签发证书，
+// 否则使用 cert-manager 挂载到 CERT_DIR 的证书。两种方式下证书更新后都会被热加载
+func setupTLS(ctx context.Context) (*tls.Config, error) {
+	certDir := envOr("CERT_DIR", "/etc/webhook/certs")
+
+	selfManaged := false
+	if v := os.Getenv("SELF_MANAGED_CERTS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("SELF_MANAGED_CERTS must be a boolean")
+		}
+		selfManaged = b
+	}
+
+	if selfManaged {
+		namespace := os.Getenv("POD_NAMESPACE")
+		if namespace == "" {
+			return nil, errors.New("POD_NAMESPACE is required when SELF_MANAGED_CERTS is enabled")
+		}
+		if kubeClient == nil {
+			return nil, errors.New("kubernetes client is required when SELF_MANAGED_CERTS is enabled")
+		}
+
+		manager := certs.NewManager(kubeClient, namespace,
+			envOr("TLS_SECRET_NAME", "terminus-tls"),
+			envOr("WEBHOOK_SERVICE_NAME", "terminus-quota-service"),
+			certDir,
+			splitList(envOr("MUTATING_WEBHOOK_CONFIGS", "terminus-quota-injector-webhook")),
+			splitList(envOr("VALIDATING_WEBHOOK_CONFIGS", "terminus-quota-validator-webhook")),
+		)
+
+		// 证书就绪前无法提供服务，一直重试到成功
+		for {
+			err := manager.Sync(ctx)
+			if err == nil {
+				break
+			}
+			klog.ErrorS(err, "Waiting for webhook certificates")
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(5 * time.Second):
+			}
+		}
+		go manager.Run(ctx, time.Hour)
+	}
+
+	reloader := certs.NewReloader(filepath.Join(certDir, corev1.TLSCertKey), filepath.Join(certDir, corev1.TLSPrivateKeyKey))
+	if err := reloader.Load(); err != nil {
+		return nil, err
+	}
+	go reloader.Run(ctx, 30*time.Second)
+
+	return &tls.Config{GetCertificate: reloader.GetCertificate}, nil
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// splitList 解析逗号分隔的列表，忽略空项
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
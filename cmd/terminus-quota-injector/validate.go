@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// protectedAnnotationPrefixes 与 protectedLabels 只允许 enforcer 写入，
+// enforcer 依赖它们恢复元数据与清理 quota，用户伪造会影响其他 Pod
+var (
+	protectedAnnotationPrefixes = []string{
+		"storage.terminus.io/project-id",
+		"emptydir.terminus.io/project-id",
+	}
+	protectedLabels = []string{
+		"storage.terminus.io/quota",
+		"emptydir.terminus.io/quota",
+	}
+
+	// quantityAnnotationPrefixes 的值必须是正的整数 Quantity
+	quantityAnnotationPrefixes = []string{
+		sizeAnnotation,
+		inodeAnnotation,
+		podSizeAnnotation,
+		ephemeralSizeAnnotation,
+		"storage.terminus.io/soft-size",
+		emptyDirInodeAnnotation,
+		"emptydir.terminus.io/soft-size",
+		emptyDirSizeAnnotation,
+	}
+)
+
+// inodeAnnotationPrefixes 为 quantityAnnotationPrefixes 中的 inode 限额，其余为字节数
+var inodeAnnotationPrefixes = []string{
+	inodeAnnotation,
+	emptyDirInodeAnnotation,
+}
+
+// maxQuotaSize 与 maxQuotaInodes 为 quantity annotation 允许的上限，由 MAX_QUOTA_SIZE 与 MAX_QUOTA_INODES 配置，
+// 误写的超大值会让限额形同虚设，也会让调度器与命名空间预算的统计溢出
+var (
+	maxQuotaSize   = resource.MustParse("64Ti")
+	maxQuotaInodes = resource.MustParse("4G")
+)
+
+// gracePeriodAnnotations 的值必须是非负的时长，可带 .<container> 或 .<volume> 后缀
+var gracePeriodAnnotations = []string{
+	"storage.terminus.io/grace-period",
+	"emptydir.terminus.io/grace-period",
+}
+
+const enforcementPolicyAnnotation = "storage.terminus.io/enforcement-policy"
+
+// protectedKeyViolations 返回非 enforcer 用户新增、修改或删除的受保护 annotation 与 label，oldPod 为空表示创建
+func protectedKeyViolations(pod, oldPod *corev1.Pod) []string {
+	var violations []string
+
+	var oldAnnotations, oldLabels map[string]string
+	if oldPod != nil {
+		oldAnnotations, oldLabels = oldPod.Annotations, oldPod.Labels
+	}
+
+	for _, key := range changedKeys(pod.Annotations, oldAnnotations) {
+		if hasAnyPrefix(key, protectedAnnotationPrefixes) {
+			violations = append(violations, fmt.Sprintf("annotation %s is managed by terminus-enforcer and cannot be set by users", key))
+		}
+	}
+
+	for _, key := range changedKeys(pod.Labels, oldLabels) {
+		for _, label := range protectedLabels {
+			if key == label {
+				violations = append(violations, fmt.Sprintf("label %s is managed by terminus-enforcer and cannot be set by users", key))
+			}
+		}
+	}
+
+	return violations
+}
+
+// malformedAnnotations 返回无法解析或超出范围的 Terminus annotation，更新时只检查发生变化的 key
+func malformedAnnotations(pod, oldPod *corev1.Pod) []string {
+	var violations []string
+
+	var oldAnnotations map[string]string
+	if oldPod != nil {
+		oldAnnotations = oldPod.Annotations
+	}
+
+	for _, key := range changedKeys(pod.Annotations, oldAnnotations) {
+		val, ok := pod.Annotations[key]
+		if !ok {
+			continue
+		}
+
+		switch {
+		case matchesAnnotation(key, gracePeriodAnnotations):
+			if d, err := time.ParseDuration(val); err != nil || d < 0 {
+				violations = append(violations, fmt.Sprintf("annotation %s=%q must be a non-negative duration such as 30m", key, val))
+			}
+		case key == enforcementPolicyAnnotation:
+			if val != "fail-open" && val != "fail-closed" {
+				violations = append(violations, fmt.Sprintf("annotation %s=%q must be fail-open or fail-closed", key, val))
+			}
+		case isQuantityAnnotation(key):
+			q, err := resource.ParseQuantity(val)
+			if err != nil {
+				violations = append(violations, fmt.Sprintf("annotation %s=%q is not a valid quantity: %v", key, val, err))
+				continue
+			}
+			if _, exact := q.AsInt64(); !exact || q.Sign() <= 0 {
+				violations = append(violations, fmt.Sprintf("annotation %s=%q must be a positive whole number", key, val))
+				continue
+			}
+			if limit := quantityLimit(key); q.Cmp(limit) > 0 {
+				violations = append(violations, fmt.Sprintf("annotation %s=%q exceeds the maximum of %s", key, val, limit.String()))
+			}
+		}
+	}
+
+	return violations
+}
+
+// isQuantityAnnotation 判断 key 是否为 prefix 或 prefix.<name>
+func isQuantityAnnotation(key string) bool {
+	return matchesAnnotation(key, quantityAnnotationPrefixes)
+}
+
+// quantityLimit 返回 quantity annotation 允许的最大值
+func quantityLimit(key string) resource.Quantity {
+	if matchesAnnotation(key, inodeAnnotationPrefixes) {
+		return maxQuotaInodes
+	}
+	return maxQuotaSize
+}
+
+// matchesAnnotation 判断 key 是否为 prefixes 中的某个 annotation 或其 .<name> 形式
+func matchesAnnotation(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if key == prefix || strings.HasPrefix(key, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// changedKeys 返回在 cur 与 old 之间新增、修改或删除的 key，按名称排序
+func changedKeys(cur, old map[string]string) []string {
+	var keys []string
+	for k, v := range cur {
+		if ov, ok := old[k]; !ok || ov != v {
+			keys = append(keys, k)
+		}
+	}
+	for k := range old {
+		if _, ok := cur[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func podWith(annotations, labels map[string]string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: annotations, Labels: labels}}
+}
+
+func TestProtectedKeyViolations(t *testing.T) {
+	tests := []struct {
+		name   string
+		pod    *corev1.Pod
+		oldPod *corev1.Pod
+		want   []string
+	}{
+		{
+			name: "create with user annotations",
+			pod:  podWith(map[string]string{sizeAnnotation: "1Gi"}, map[string]string{"app": "web"}),
+		},
+		{
+			name: "create with forged project id",
+			pod:  podWith(map[string]string{"storage.terminus.io/project-id.app": "42"}, nil),
+			want: []string{"annotation storage.terminus.io/project-id.app"},
+		},
+		{
+			name: "create with forged emptyDir label",
+			pod:  podWith(nil, map[string]string{"emptydir.terminus.io/quota": "enabled"}),
+			want: []string{"label emptydir.terminus.io/quota"},
+		},
+		{
+			name:   "update keeps enforcer keys unchanged",
+			pod:    podWith(map[string]string{"emptydir.terminus.io/project-id.cache": "900000001", sizeAnnotation: "2Gi"}, map[string]string{"storage.terminus.io/quota": "enabled"}),
+			oldPod: podWith(map[string]string{"emptydir.terminus.io/project-id.cache": "900000001", sizeAnnotation: "1Gi"}, map[string]string{"storage.terminus.io/quota": "enabled"}),
+		},
+		{
+			name:   "update changes project id",
+			pod:    podWith(map[string]string{"storage.terminus.io/project-id.app": "43"}, nil),
+			oldPod: podWith(map[string]string{"storage.terminus.io/project-id.app": "42"}, nil),
+			want:   []string{"annotation storage.terminus.io/project-id.app"},
+		},
+		{
+			name:   "update removes quota label",
+			pod:    podWith(nil, nil),
+			oldPod: podWith(nil, map[string]string{"storage.terminus.io/quota": "enabled"}),
+			want:   []string{"label storage.terminus.io/quota"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := protectedKeyViolations(tt.pod, tt.oldPod)
+			assertViolations(t, got, tt.want)
+		})
+	}
+}
+
+func TestMalformedAnnotations(t *testing.T) {
+	tests := []struct {
+		name   string
+		pod    *corev1.Pod
+		oldPod *corev1.Pod
+		want   []string
+	}{
+		{
+			name: "valid values",
+			pod: podWith(map[string]string{
+				sizeAnnotation:                          "10Gi",
+				inodeAnnotation + ".app":                "500k",
+				"emptydir.terminus.io/soft-size.cache":  "1Gi",
+				"storage.terminus.io/grace-period":      "30m",
+				"emptydir.terminus.io/grace-period":     "0s",
+				enforcementPolicyAnnotation:             "fail-closed",
+				"storage.terminus.io/unrelated-setting": "anything",
+			}, nil),
+		},
+		{
+			name: "unparsable size",
+			pod:  podWith(map[string]string{sizeAnnotation + ".app": "ten gigs"}, nil),
+			want: []string{"storage.terminus.io/size.app=\"ten gigs\" is not a valid quantity"},
+		},
+		{
+			name: "zero and fractional values",
+			pod:  podWith(map[string]string{podSizeAnnotation: "0", emptyDirInodeAnnotation: "0.5"}, nil),
+			want: []string{
+				"emptydir.terminus.io/inodes=\"0.5\" must be a positive whole number",
+				"storage.terminus.io/pod-size=\"0\" must be a positive whole number",
+			},
+		},
+		{
+			name: "size above the maximum",
+			pod:  podWith(map[string]string{sizeAnnotation: "65Ti"}, nil),
+			want: []string{"storage.terminus.io/size=\"65Ti\" exceeds the maximum of 64Ti"},
+		},
+		{
+			name: "inodes checked against the inode maximum",
+			pod:  podWith(map[string]string{inodeAnnotation: "5G", sizeAnnotation: "5G"}, nil),
+			want: []string{"storage.terminus.io/inodes=\"5G\" exceeds the maximum of 4G"},
+		},
+		{
+			name: "bad grace period and policy",
+			pod:  podWith(map[string]string{"storage.terminus.io/grace-period.app": "-1m", enforcementPolicyAnnotation: "fail-soft"}, nil),
+			want: []string{
+				"storage.terminus.io/enforcement-policy=\"fail-soft\" must be fail-open or fail-closed",
+				"storage.terminus.io/grace-period.app=\"-1m\" must be a non-negative duration",
+			},
+		},
+		{
+			name:   "unchanged malformed value is not rechecked on update",
+			pod:    podWith(map[string]string{sizeAnnotation: "100Ti", "team": "a"}, nil),
+			oldPod: podWith(map[string]string{sizeAnnotation: "100Ti"}, nil),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := malformedAnnotations(tt.pod, tt.oldPod)
+			assertViolations(t, got, tt.want)
+		})
+	}
+}
+
+// assertViolations 按顺序检查每条违规信息包含期望的片段
+func assertViolations(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d violations %q, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if !strings.Contains(got[i], want[i]) {
+			t.Errorf("violation %d = %q, want it to contain %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package budget
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/terminus-io/Terminus/pkg/policy"
+	"github.com/terminus-io/Terminus/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// Tracker 通过 informer 汇总各命名空间存活 Pod 声明的存储，准入时检查预算并定期更新预算的 status。
+// 检查基于本地缓存，并发创建的 Pod 可能短暂超出预算
+type Tracker struct {
+	kClient   kubernetes.Interface
+	dynClient dynamic.Interface
+	Interval  time.Duration
+
+	podLister    corelisters.PodLister
+	budgetLister cache.GenericLister
+
+	synced atomic.Bool
+}
+
+func NewTracker(kClient kubernetes.Interface, dynClient dynamic.Interface, interval time.Duration) *Tracker {
+	return &Tracker{
+		kClient:   kClient,
+		dynClient: dynClient,
+		Interval:  interval,
+	}
+}
+
+// Run 启动 informer 并周期性更新预算的 status，直到 ctx 结束
+func (t *Tracker) Run(ctx context.Context) {
+	if _, err := t.kClient.Discovery().ServerResourcesForGroupVersion(policy.GroupName + "/" + policy.Version); err != nil {
+		klog.InfoS("Storage budget CRD not installed, budgets disabled", "err", err)
+		return
+	}
+
+	dynFactory := dynamicinformer.NewDynamicSharedInformerFactory(t.dynClient, 0)
+	budgetInformer := dynFactory.ForResource(TerminusStorageBudgetResource)
+
+	factory := informers.NewSharedInformerFactory(t.kClient, 0)
+	podInformer := factory.Core().V1().Pods()
+
+	t.budgetLister = budgetInformer.Lister()
+	t.podLister = podInformer.Lister()
+	budgetInformer.Informer()
+	podInformer.Informer()
+
+	dynFactory.Start(ctx.Done())
+	factory.Start(ctx.Done())
+	defer dynFactory.Shutdown()
+	defer factory.Shutdown()
+
+	if !cache.WaitForCacheSync(ctx.Done(), budgetInformer.Informer().HasSynced, podInformer.Informer().HasSynced) {
+		return
+	}
+	t.synced.Store(true)
+	klog.InfoS("Storage budget cache synced", "interval", t.Interval)
+
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+
+	for {
+		t.updateStatus(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check 判断 Pod 加入后命名空间是否超出预算。oldPod 不为空时按更新前后的差值计算，缓存未同步时放行
+func (t *Tracker) Check(namespace string, pod, oldPod *v1.Pod) error {
+	if t == nil || !t.synced.Load() {
+		return nil
+	}
+
+	demand := utils.GetPodStorageDemand(pod)
+	if oldPod != nil {
+		demand -= utils.GetPodStorageDemand(oldPod)
+	}
+	if demand <= 0 {
+		return nil
+	}
+
+	budgets := t.budgets(namespace)
+	if len(budgets) == 0 {
+		return nil
+	}
+
+	used, _ := t.usage(namespace)
+	for _, b := range budgets {
+		if used+demand > b.Spec.Hard.Value() {
+			return fmt.Errorf("pod requests %s of Terminus storage, namespace %s has used %s of %s allowed by TerminusStorageBudget %s",
+				quantity(demand).String(), namespace, quantity(used).String(), b.Spec.Hard.String(), b.Name)
+		}
+	}
+	return nil
+}
+
+// usage 汇总命名空间内未结束 Pod 声明的存储
+func (t *Tracker) usage(namespace string) (int64, int) {
+	pods, err := t.podLister.Pods(namespace).List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "Failed to list pods", "namespace", namespace)
+		return 0, 0
+	}
+
+	var used int64
+	count := 0
+	for _, pod := range pods {
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		if size := utils.GetPodStorageDemand(pod); size > 0 {
+			used += size
+			count++
+		}
+	}
+	return used, count
+}
+
+func (t *Tracker) budgets(namespace string) []TerminusStorageBudget {
+	var objs []runtime.Object
+	var err error
+	if namespace == "" {
+		objs, err = t.budgetLister.List(labels.Everything())
+	} else {
+		objs, err = t.budgetLister.ByNamespace(namespace).List(labels.Everything())
+	}
+	if err != nil {
+		klog.ErrorS(err, "Failed to list storage budgets", "namespace", namespace)
+		return nil
+	}
+
+	budgets := make([]TerminusStorageBudget, 0, len(objs))
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		var b TerminusStorageBudget
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &b); err != nil {
+			klog.ErrorS(err, "Invalid storage budget, ignoring", "namespace", u.GetNamespace(), "name", u.GetName())
+			continue
+		}
+		budgets = append(budgets, b)
+	}
+	return budgets
+}
+
+// updateStatus 将各命名空间的用量写回预算的 status，用量未变化时跳过
+func (t *Tracker) updateStatus(ctx context.Context) {
+	for _, b := range t.budgets("") {
+		used, pods := t.usage(b.Namespace)
+		usedQuantity := quantity(used)
+		if b.Status.Pods == pods && b.Status.Used.Cmp(*usedQuantity) == 0 {
+			continue
+		}
+
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion(policy.GroupName + "/" + policy.Version)
+		u.SetKind("TerminusStorageBudget")
+		u.SetNamespace(b.Namespace)
+		u.SetName(b.Name)
+		u.SetResourceVersion(b.ResourceVersion)
+		u.Object["spec"] = map[string]interface{}{"hard": b.Spec.Hard.String()}
+		u.Object["status"] = map[string]interface{}{
+			"used": usedQuantity.String(),
+			"pods": int64(pods),
+		}
+
+		if _, err := t.dynClient.Resource(TerminusStorageBudgetResource).Namespace(b.Namespace).UpdateStatus(ctx, u, metav1.UpdateOptions{}); err != nil {
+			klog.ErrorS(err, "Failed to update storage budget status", "namespace", b.Namespace, "name", b.Name)
+			continue
+		}
+		klog.V(4).InfoS("Storage budget status updated", "namespace", b.Namespace, "name", b.Name, "used", usedQuantity.String(), "pods", pods)
+	}
+}
+
+func quantity(bytes int64) *resource.Quantity {
+	return resource.NewQuantity(bytes, resource.BinarySI)
+}
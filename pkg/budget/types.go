@@ -0,0 +1,32 @@
+package budget
+
+import (
+	"github.com/terminus-io/Terminus/pkg/policy"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// TerminusStorageBudgetResource 是命名空间级的存储预算
+var TerminusStorageBudgetResource = schema.GroupVersionResource{Group: policy.GroupName, Version: policy.Version, Resource: "terminusstoragebudgets"}
+
+// TerminusStorageBudget 限制命名空间内所有存活 Pod 声明的 Terminus 存储总量
+type TerminusStorageBudget struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BudgetSpec   `json:"spec"`
+	Status BudgetStatus `json:"status,omitempty"`
+}
+
+type BudgetSpec struct {
+	// Hard 是命名空间内允许声明的存储总量
+	Hard resource.Quantity `json:"hard"`
+}
+
+type BudgetStatus struct {
+	// Used 是命名空间内存活 Pod 声明的存储总量
+	Used resource.Quantity `json:"used"`
+	// Pods 是计入 Used 的 Pod 数量
+	Pods int `json:"pods"`
+}
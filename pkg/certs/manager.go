@@ -0,0 +1,273 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// CABundleKey 为 Secret 中的 CA 证书，轮换 CA 期间同时包含新旧两张
+	CABundleKey = "ca.crt"
+	// CAPrivateKeyKey 为 CA 私钥，用于续签服务端证书
+	CAPrivateKeyKey = "ca.key"
+
+	// 剩余有效期低于该值时轮换
+	caRotateBefore      = 90 * 24 * time.Hour
+	servingRotateBefore = 30 * 24 * time.Hour
+)
+
+// Manager 在不依赖 cert-manager 时管理 webhook 证书：生成 CA 与服务端证书并保存在 Secret 中，
+// 到期前轮换，将证书写入本地目录并更新 webhook 配置的 caBundle。多个副本共享同一个 Secret，
+// 通过 resourceVersion 冲突保证同一时刻只有一个副本的轮换生效
+type Manager struct {
+	kClient    kubernetes.Interface
+	Namespace  string
+	SecretName string
+	// ServiceName 为 webhook Service 名称，用于生成证书的 DNS 名称
+	ServiceName string
+	CertDir     string
+
+	MutatingWebhooks   []string
+	ValidatingWebhooks []string
+}
+
+func NewManager(kClient kubernetes.Interface, namespace, secretName, serviceName, certDir string, mutatingWebhooks, validatingWebhooks []string) *Manager {
+	return &Manager{
+		kClient:            kClient,
+		Namespace:          namespace,
+		SecretName:         secretName,
+		ServiceName:        serviceName,
+		CertDir:            certDir,
+		MutatingWebhooks:   mutatingWebhooks,
+		ValidatingWebhooks: validatingWebhooks,
+	}
+}
+
+// Run 每隔 interval 同步一次证书，直到 ctx 结束
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := m.Sync(ctx); err != nil {
+			klog.ErrorS(err, "Failed to sync webhook certificates", "secret", m.Namespace+"/"+m.SecretName)
+		}
+	}
+}
+
+// Sync 确保 Secret 中的证书有效，并将其写入 CertDir、更新 caBundle
+func (m *Manager) Sync(ctx context.Context) error {
+	secret, err := m.kClient.CoreV1().Secrets(m.Namespace).Get(ctx, m.SecretName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: m.SecretName, Namespace: m.Namespace},
+			Type:       corev1.SecretTypeTLS,
+		}
+	} else if err != nil {
+		return fmt.Errorf("get secret: %w", err)
+	}
+
+	data, rotated, err := m.renew(secret.Data, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if rotated {
+		secret.Data = data
+		if secret.ResourceVersion == "" {
+			secret, err = m.kClient.CoreV1().Secrets(m.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+		} else {
+			secret, err = m.kClient.CoreV1().Secrets(m.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			// 其他副本已写入新证书，下次同步时使用
+			return fmt.Errorf("store secret: %w", err)
+		}
+		klog.InfoS("Webhook certificates rotated", "secret", m.Namespace+"/"+m.SecretName)
+	}
+
+	if err := m.writeFiles(secret.Data); err != nil {
+		return err
+	}
+	return m.patchCABundle(ctx, secret.Data[CABundleKey])
+}
+
+// renew 检查 Secret 数据，返回需要写回的数据以及是否发生了轮换
+func (m *Manager) renew(data map[string][]byte, now time.Time) (map[string][]byte, bool, error) {
+	bundle := parseBundle(data[CABundleKey])
+	ca := keyPair{key: data[CAPrivateKeyKey]}
+	if len(bundle) > 0 {
+		ca.cert = encodeBundle(bundle[:1])
+	}
+
+	caCert, _, err := parse(ca)
+	caValid := err == nil && now.Add(caRotateBefore).Before(caCert.NotAfter)
+
+	servingValid := false
+	if caValid {
+		servingValid = m.servingValid(data[corev1.TLSCertKey], caCert, now)
+	}
+	if caValid && servingValid {
+		return data, false, nil
+	}
+
+	if !caValid {
+		if ca, err = newCA("terminus-webhook-ca", now); err != nil {
+			return nil, false, fmt.Errorf("generate CA: %w", err)
+		}
+		newCACert, _ := parseCert(ca.cert)
+
+		// 旧 CA 仍未过期时保留在 bundle 中，未加载新证书的副本可以继续提供服务
+		bundle = append([]*x509.Certificate{newCACert}, unexpired(bundle, now)...)
+		if len(bundle) > 2 {
+			bundle = bundle[:2]
+		}
+	}
+
+	serving, err := newServingCert(ca, m.dnsNames(), now)
+	if err != nil {
+		return nil, false, fmt.Errorf("generate serving certificate: %w", err)
+	}
+
+	return map[string][]byte{
+		CABundleKey:             encodeBundle(bundle),
+		CAPrivateKeyKey:         ca.key,
+		corev1.TLSCertKey:       serving.cert,
+		corev1.TLSPrivateKeyKey: serving.key,
+	}, true, nil
+}
+
+// servingValid 判断服务端证书由当前 CA 签发、包含所需 DNS 名称且未临近过期
+func (m *Manager) servingValid(certPEM []byte, ca *x509.Certificate, now time.Time) bool {
+	cert, err := parseCert(certPEM)
+	if err != nil || !now.Add(servingRotateBefore).Before(cert.NotAfter) {
+		return false
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		return false
+	}
+	for _, name := range m.dnsNames() {
+		if cert.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Manager) dnsNames() []string {
+	return []string{
+		fmt.Sprintf("%s.%s.svc", m.ServiceName, m.Namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", m.ServiceName, m.Namespace),
+		fmt.Sprintf("%s.%s", m.ServiceName, m.Namespace),
+		m.ServiceName,
+	}
+}
+
+// writeFiles 将证书写入 CertDir，内容未变化时跳过。先写临时文件再重命名，避免读取到写了一半的文件
+func (m *Manager) writeFiles(data map[string][]byte) error {
+	if err := os.MkdirAll(m.CertDir, 0o700); err != nil {
+		return err
+	}
+
+	// 先写私钥再写证书，Reloader 以证书变化作为重新加载的信号
+	for _, name := range []string{corev1.TLSPrivateKeyKey, corev1.TLSCertKey, CABundleKey} {
+		path := filepath.Join(m.CertDir, name)
+		if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, data[name]) {
+			continue
+		}
+
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, data[name], 0o600); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchCABundle 将 caBundle 写入指定的 webhook 配置，配置不存在时跳过
+func (m *Manager) patchCABundle(ctx context.Context, caBundle []byte) error {
+	admission := m.kClient.AdmissionregistrationV1()
+
+	for _, name := range m.MutatingWebhooks {
+		cfg, err := admission.MutatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			klog.V(4).InfoS("Mutating webhook configuration not found, skipping caBundle", "name", name)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("get mutating webhook %s: %w", name, err)
+		}
+
+		changed := false
+		for i := range cfg.Webhooks {
+			if !bytes.Equal(cfg.Webhooks[i].ClientConfig.CABundle, caBundle) {
+				cfg.Webhooks[i].ClientConfig.CABundle = caBundle
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if _, err := admission.MutatingWebhookConfigurations().Update(ctx, cfg, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("update mutating webhook %s: %w", name, err)
+		}
+		klog.InfoS("Webhook caBundle updated", "mutatingWebhookConfiguration", name)
+	}
+
+	for _, name := range m.ValidatingWebhooks {
+		cfg, err := admission.ValidatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			klog.V(4).InfoS("Validating webhook configuration not found, skipping caBundle", "name", name)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("get validating webhook %s: %w", name, err)
+		}
+
+		changed := false
+		for i := range cfg.Webhooks {
+			if !bytes.Equal(cfg.Webhooks[i].ClientConfig.CABundle, caBundle) {
+				cfg.Webhooks[i].ClientConfig.CABundle = caBundle
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if _, err := admission.ValidatingWebhookConfigurations().Update(ctx, cfg, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("update validating webhook %s: %w", name, err)
+		}
+		klog.InfoS("Webhook caBundle updated", "validatingWebhookConfiguration", name)
+	}
+
+	return nil
+}
+
+// unexpired 返回尚未过期的证书
+func unexpired(certs []*x509.Certificate, now time.Time) []*x509.Certificate {
+	var valid []*x509.Certificate
+	for _, cert := range certs {
+		if now.Before(cert.NotAfter) {
+			valid = append(valid, cert)
+		}
+	}
+	return valid
+}
@@ -0,0 +1,124 @@
+package certs
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestManagerRenew(t *testing.T) {
+	const day = 24 * time.Hour
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m := NewManager(nil, "terminus", "terminus-tls", "terminus-quota-service", "", nil, nil)
+	initial, rotated, err := m.renew(nil, t0)
+	if err != nil || !rotated {
+		t.Fatalf("renew(empty) = rotated %v, err %v, want a new certificate", rotated, err)
+	}
+
+	copyData := func(mutate func(map[string][]byte)) map[string][]byte {
+		data := make(map[string][]byte, len(initial))
+		for k, v := range initial {
+			data[k] = v
+		}
+		if mutate != nil {
+			mutate(data)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name        string
+		manager     *Manager
+		data        map[string][]byte
+		now         time.Time
+		wantRotated bool
+		wantNewCA   bool
+		wantBundle  int
+	}{
+		{
+			name:       "valid certificates are kept",
+			data:       copyData(nil),
+			now:        t0.Add(day),
+			wantBundle: 1,
+		},
+		{
+			name:        "serving certificate close to expiry is reissued by the same CA",
+			data:        copyData(nil),
+			now:         t0.Add(servingValidity - servingRotateBefore + day),
+			wantRotated: true,
+			wantBundle:  1,
+		},
+		{
+			name:        "serving certificate without the service DNS names is reissued",
+			manager:     NewManager(nil, "terminus", "terminus-tls", "other-service", "", nil, nil),
+			data:        copyData(nil),
+			now:         t0.Add(day),
+			wantRotated: true,
+			wantBundle:  1,
+		},
+		{
+			name:        "serving certificate missing",
+			data:        copyData(func(d map[string][]byte) { delete(d, corev1.TLSCertKey) }),
+			now:         t0.Add(day),
+			wantRotated: true,
+			wantBundle:  1,
+		},
+		{
+			name:        "CA close to expiry is rotated and the old CA stays in the bundle",
+			data:        copyData(nil),
+			now:         t0.Add(caValidity - caRotateBefore + day),
+			wantRotated: true,
+			wantNewCA:   true,
+			wantBundle:  2,
+		},
+		{
+			name:        "expired CA is dropped from the bundle",
+			data:        copyData(nil),
+			now:         t0.Add(caValidity + day),
+			wantRotated: true,
+			wantNewCA:   true,
+			wantBundle:  1,
+		},
+		{
+			name:        "unreadable CA key",
+			data:        copyData(func(d map[string][]byte) { d[CAPrivateKeyKey] = []byte("garbage") }),
+			now:         t0.Add(day),
+			wantRotated: true,
+			wantNewCA:   true,
+			wantBundle:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := tt.manager
+			if manager == nil {
+				manager = m
+			}
+
+			got, rotated, err := manager.renew(tt.data, tt.now)
+			if err != nil {
+				t.Fatalf("renew() error = %v", err)
+			}
+			if rotated != tt.wantRotated {
+				t.Fatalf("renew() rotated = %v, want %v", rotated, tt.wantRotated)
+			}
+
+			newCA := !bytes.Equal(got[CAPrivateKeyKey], initial[CAPrivateKeyKey])
+			if newCA != tt.wantNewCA {
+				t.Errorf("new CA = %v, want %v", newCA, tt.wantNewCA)
+			}
+
+			bundle := parseBundle(got[CABundleKey])
+			if len(bundle) != tt.wantBundle {
+				t.Fatalf("CA bundle has %d certificates, want %d", len(bundle), tt.wantBundle)
+			}
+			if !manager.servingValid(got[corev1.TLSCertKey], bundle[0], tt.now) {
+				t.Errorf("serving certificate is not valid for the first CA in the bundle")
+			}
+		})
+	}
+}
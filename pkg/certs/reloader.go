@@ -0,0 +1,88 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Reloader 定期检查磁盘上的证书，内容变化时重新加载，无需重启即可使用轮换后的证书。
+// cert-manager 更新挂载的 Secret 与 Manager 写入本地文件两种方式都适用
+type Reloader struct {
+	CertFile string
+	KeyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func NewReloader(certFile, keyFile string) *Reloader {
+	return &Reloader{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}
+}
+
+// Load 读取证书，内容未变化时不做处理
+func (r *Reloader) Load() error {
+	certPEM, err := os.ReadFile(r.CertFile)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := os.ReadFile(r.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	unchanged := bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM)
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert, r.certPEM, r.keyPEM = &cert, certPEM, keyPEM
+	r.mu.Unlock()
+
+	klog.InfoS("Webhook serving certificate loaded", "cert", r.CertFile)
+	return nil
+}
+
+// Run 每隔 interval 重新加载一次证书，直到 ctx 结束。加载失败时继续使用旧证书
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// 证书与私钥可能分两次写入，失败时等待下一轮
+		if err := r.Load(); err != nil {
+			klog.ErrorS(err, "Failed to reload webhook certificate, keeping the current one", "cert", r.CertFile)
+		}
+	}
+}
+
+// GetCertificate 用于 tls.Config，返回最近一次加载的证书
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
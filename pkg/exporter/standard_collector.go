@@ -2,6 +2,7 @@ package exporter
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/terminus-io/Terminus/pkg/metadata"
@@ -33,6 +34,18 @@ var (
 		[]string{"namespace", "pod", "container", "mount_point", "project_id", "volume_name", "storage_type"}, nil,
 	)
 
+	// 软限制指标
+	descBytesSoftLimit = prometheus.NewDesc(
+		"terminus_storage_soft_limit_bytes",
+		"Storage soft limit in bytes per project ID",
+		[]string{"namespace", "pod", "container", "mount_point", "project_id", "volume_name", "storage_type"}, nil,
+	)
+	descGraceRemaining = prometheus.NewDesc(
+		"terminus_storage_grace_remaining_seconds",
+		"Seconds left in the advisory grace period, only exposed while usage exceeds the soft limit and a grace period is set",
+		[]string{"namespace", "pod", "container", "mount_point", "project_id", "volume_name", "storage_type"}, nil,
+	)
+
 	maxID = uint32(999999999)
 )
 
@@ -55,6 +68,8 @@ func (c *StandardCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- descBytesLimit
 	ch <- descInodesUsed
 	ch <- descInodesLimit
+	ch <- descBytesSoftLimit
+	ch <- descGraceRemaining
 }
 
 func (c *StandardCollector) Collect(ch chan<- prometheus.Metric) {
@@ -69,6 +84,7 @@ func (c *StandardCollector) Collect(ch chan<- prometheus.Metric) {
 				continue
 			}
 
+			// Pod 级共享限额按 containerd 目录所在文件系统上报，container 标签为空
 			mountPoint := c.mountPoint
 			if containerInfo.StorageType == metadata.EMPTYDIR_TYPE {
 				mountPoint = c.kubeletMountPoint
@@ -81,9 +97,39 @@ func (c *StandardCollector) Collect(ch chan<- prometheus.Metric) {
 				containerInfo.Namespace, containerInfo.PodName, containerInfo.ContainerName, mountPoint, idStr, containerInfo.VolumeName, string(containerInfo.StorageType))
 			ch <- prometheus.MustNewConstMetric(descInodesUsed, prometheus.GaugeValue, float64(r.CurrentInodes),
 				containerInfo.Namespace, containerInfo.PodName, containerInfo.ContainerName, mountPoint, idStr, containerInfo.VolumeName, string(containerInfo.StorageType))
-			ch <- prometheus.MustNewConstMetric(descInodesLimit, prometheus.GaugeValue, float64(r.BlockHardLimit),
+			ch <- prometheus.MustNewConstMetric(descInodesLimit, prometheus.GaugeValue, float64(r.InodeHardLimit),
+				containerInfo.Namespace, containerInfo.PodName, containerInfo.ContainerName, mountPoint, idStr, containerInfo.VolumeName, string(containerInfo.StorageType))
+
+			if r.BlockSoftLimit == 0 {
+				continue
+			}
+
+			ch <- prometheus.MustNewConstMetric(descBytesSoftLimit, prometheus.GaugeValue, float64(r.BlockSoftLimit*1024),
 				containerInfo.Namespace, containerInfo.PodName, containerInfo.ContainerName, mountPoint, idStr, containerInfo.VolumeName, string(containerInfo.StorageType))
+
+			if remaining, ok := c.graceRemaining(r, containerInfo); ok {
+				ch <- prometheus.MustNewConstMetric(descGraceRemaining, prometheus.GaugeValue, remaining.Seconds(),
+					containerInfo.Namespace, containerInfo.PodName, containerInfo.ContainerName, mountPoint, idStr, containerInfo.VolumeName, string(containerInfo.StorageType))
+			}
 		}
 
 	}
 }
+
+// graceRemaining 返回 Terminus 记录的宽限期剩余时间，未配置宽限期时不导出
+func (c *StandardCollector) graceRemaining(r terminus_quota.QuotaInfo, info metadata.ContainerInfo) (time.Duration, bool) {
+	if r.CurrentBlocks <= r.BlockSoftLimit {
+		return 0, false
+	}
+
+	since, ok := c.store.SoftLimitExceededSince(r.ID)
+	if !ok || info.GracePeriod <= 0 {
+		return 0, false
+	}
+
+	remaining := info.GracePeriod - time.Since(since)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
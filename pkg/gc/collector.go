@@ -0,0 +1,266 @@
+package gc
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/terminus-io/Terminus/pkg/metadata"
+	"github.com/terminus-io/Terminus/pkg/nri"
+	"github.com/terminus-io/Terminus/pkg/utils"
+	terminus_quota "github.com/terminus-io/quota"
+	"k8s.io/klog/v2"
+)
+
+const (
+	emptyDirVolumeDir = "volumes/kubernetes.io~empty-dir"
+
+	actionRemoved = "removed"
+	actionDryRun  = "dry_run"
+	actionFailed  = "failed"
+)
+
+var (
+	orphansCollected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "terminus_gc_orphaned_quotas_total",
+		Help: "Orphaned project quotas handled by the garbage collector",
+	}, []string{"mount_point", "action"})
+	orphanBytesCollected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "terminus_gc_orphaned_quota_bytes_total",
+		Help: "Bytes still charged to orphaned project quotas when they were handled",
+	}, []string{"mount_point", "action"})
+	orphanCandidates = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "terminus_gc_orphan_candidates",
+		Help: "Project quotas without an owner that are waiting for the safety delay",
+	}, []string{"mount_point"})
+	lastRunTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "terminus_gc_last_run_timestamp_seconds",
+		Help: "Unix time of the last completed garbage collection pass",
+	})
+)
+
+var _ nri.Hook = &QuotaGC{}
+
+// Collectors 返回需要注册到 metrics server 的 GC 指标
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{orphansCollected, orphanBytesCollected, orphanCandidates, lastRunTimestamp}
+}
+
+// QuotaGC 周期性地回收没有归属的 project quota：
+// 在 containerd 与 kubelet 挂载点上列出 quota，与存活容器的 snapshot ID 和存活 emptyDir 的 ProjectID 比对，
+// 超过安全延迟仍无归属的 quota 会被删除
+type QuotaGC struct {
+	nri.BaseHook
+
+	containerdPath   string
+	kubeletPath      string
+	containerdClient *utils.ContainerdClientWrapper
+	containerdCtx    context.Context
+	store            *metadata.AsyncStore
+	allocator        *utils.ProjectIDAllocator
+
+	Interval    time.Duration
+	SafetyDelay time.Duration
+	DryRun      bool
+
+	mu       sync.Mutex
+	orphans  map[uint32]time.Time
+	observed map[uint32]time.Time
+}
+
+func NewQuotaGC(store *metadata.AsyncStore, allocator *utils.ProjectIDAllocator, wrapper *utils.ContainerdClientWrapper, containerdCtx context.Context,
+	containerdPath, kubeletPath string, interval, safetyDelay time.Duration, dryRun bool) *QuotaGC {
+	return &QuotaGC{
+		containerdPath:   containerdPath,
+		kubeletPath:      kubeletPath,
+		containerdClient: wrapper,
+		containerdCtx:    containerdCtx,
+		store:            store,
+		allocator:        allocator,
+		Interval:         interval,
+		SafetyDelay:      safetyDelay,
+		DryRun:           dryRun,
+		orphans:          make(map[uint32]time.Time),
+		observed:         make(map[uint32]time.Time),
+	}
+}
+
+// Observe 记录由其他来源（例如 NRI Synchronize）确认存活的 ProjectID，
+// 在下一个安全延迟内不会被回收
+func (g *QuotaGC) Observe(ids ...uint32) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	for _, id := range ids {
+		g.observed[id] = now
+	}
+}
+
+func (g *QuotaGC) Name() string { return "QuotaGC" }
+
+// Synchronize 将 NRI 上报的存活容器的 snapshot ID 标记为存活
+func (g *QuotaGC) Synchronize(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container) error {
+	for _, container := range containers {
+		if container.State == api.ContainerState_CONTAINER_STOPPED {
+			continue
+		}
+		layer, err := g.containerdClient.ResolveWritableLayer(g.containerdCtx, container.Id, container.PodSandboxId)
+		if err != nil {
+			continue
+		}
+		g.Observe(layer.ProjectID)
+	}
+	return nil
+}
+
+func (g *QuotaGC) Run(ctx context.Context) {
+	klog.InfoS("Starting quota garbage collector", "interval", g.Interval, "safetyDelay", g.SafetyDelay, "dryRun", g.DryRun)
+	ticker := time.NewTicker(g.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			klog.Info("Quota garbage collector stopped")
+			return
+		case <-ticker.C:
+			g.collect()
+		}
+	}
+}
+
+func (g *QuotaGC) collect() {
+	live, err := g.liveProjectIDs()
+	if err != nil {
+		// 无法确认存活集合时宁可跳过本轮，避免误删
+		klog.ErrorS(err, "[gc] Failed to build live project ID set, skipping this pass")
+		return
+	}
+
+	now := time.Now()
+	seen := make(map[uint32]bool)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for id, at := range g.observed {
+		if now.Sub(at) < g.SafetyDelay {
+			live[id] = true
+		} else {
+			delete(g.observed, id)
+		}
+	}
+
+	for _, mountPoint := range []string{g.containerdPath, g.kubeletPath} {
+		quotaInfos, err := terminus_quota.ListQuotas(mountPoint, terminus_quota.ProjQuota, utils.MaxProjectID)
+		if err != nil {
+			klog.ErrorS(err, "[gc] Failed to list project quotas", "mountPoint", mountPoint)
+			continue
+		}
+
+		candidates := 0
+		for _, r := range quotaInfos {
+			if r.ID == 0 || seen[r.ID] {
+				continue
+			}
+			if r.BlockHardLimit == 0 && r.BlockSoftLimit == 0 && r.InodeHardLimit == 0 && r.InodeSoftLimit == 0 {
+				continue
+			}
+			seen[r.ID] = true
+
+			if live[r.ID] {
+				delete(g.orphans, r.ID)
+				continue
+			}
+
+			firstSeen, ok := g.orphans[r.ID]
+			if !ok {
+				g.orphans[r.ID] = now
+				klog.V(2).InfoS("[gc] Found project quota without owner", "projectID", r.ID, "mountPoint", mountPoint)
+			}
+			if !ok || now.Sub(firstSeen) < g.SafetyDelay {
+				candidates++
+				continue
+			}
+
+			g.remove(mountPoint, r)
+		}
+		orphanCandidates.WithLabelValues(mountPoint).Set(float64(candidates))
+	}
+
+	for id := range g.orphans {
+		if !seen[id] {
+			delete(g.orphans, id)
+		}
+	}
+
+	lastRunTimestamp.SetToCurrentTime()
+}
+
+func (g *QuotaGC) remove(mountPoint string, r terminus_quota.QuotaInfo) {
+	usedBytes := float64(r.CurrentBlocks * 1024)
+
+	if g.DryRun {
+		klog.InfoS("[gc] Dry run, would remove orphaned project quota", "projectID", r.ID, "mountPoint", mountPoint, "usedBytes", usedBytes)
+		orphansCollected.WithLabelValues(mountPoint, actionDryRun).Inc()
+		orphanBytesCollected.WithLabelValues(mountPoint, actionDryRun).Add(usedBytes)
+		return
+	}
+
+	if err := terminus_quota.RemoveQuota(mountPoint, r.ID, terminus_quota.ProjQuota); err != nil {
+		klog.ErrorS(err, "[gc] Failed to remove orphaned project quota", "projectID", r.ID, "mountPoint", mountPoint)
+		orphansCollected.WithLabelValues(mountPoint, actionFailed).Inc()
+		return
+	}
+
+	g.store.TriggerDelete(r.ID)
+	g.allocator.Release(r.ID)
+	delete(g.orphans, r.ID)
+
+	klog.InfoS("[gc] Removed orphaned project quota", "projectID", r.ID, "mountPoint", mountPoint, "usedBytes", usedBytes)
+	orphansCollected.WithLabelValues(mountPoint, actionRemoved).Inc()
+	orphanBytesCollected.WithLabelValues(mountPoint, actionRemoved).Add(usedBytes)
+}
+
+// liveProjectIDs 汇总节点上仍然存活的 ProjectID：containerd 中所有容器的 snapshot ID，
+// 以及 kubelet 目录下仍存在的 emptyDir 目录上设置的 ProjectID
+func (g *QuotaGC) liveProjectIDs() (map[uint32]bool, error) {
+	live := make(map[uint32]bool)
+
+	containers, err := g.containerdClient.Containers(g.containerdCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range containers {
+		layer, err := g.containerdClient.ResolveWritableLayer(g.containerdCtx, c.ID(), "")
+		if err != nil {
+			klog.V(4).InfoS("[gc] Failed to resolve writable layer", "containerID", c.ID(), "err", err)
+			continue
+		}
+		live[layer.ProjectID] = true
+
+		// 使用 Pod 级共享限额的容器，可写层上设置的是 Pod 的 ProjectID 而不是 snapshot ID
+		if id, err := terminus_quota.GetProjectID(layer.UpperDir); err == nil && id > 0 {
+			live[uint32(id)] = true
+		}
+	}
+
+	volumeDirs, err := filepath.Glob(filepath.Join(g.kubeletPath, "pods", "*", emptyDirVolumeDir, "*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range volumeDirs {
+		id, err := terminus_quota.GetProjectID(dir)
+		if err != nil || id <= 0 {
+			continue
+		}
+		live[uint32(id)] = true
+	}
+
+	klog.V(4).InfoS("[gc] Live project IDs", "count", len(live), "containers", len(containers), "emptyDirs", len(volumeDirs))
+	return live, nil
+}
@@ -3,16 +3,20 @@ package hooks
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strconv"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/containerd/nri/pkg/api"
 	"github.com/terminus-io/Terminus/pkg/metadata"
 	"github.com/terminus-io/Terminus/pkg/nri"
+	"github.com/terminus-io/Terminus/pkg/policy"
 	"github.com/terminus-io/Terminus/pkg/utils"
 	terminus_quota "github.com/terminus-io/quota"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
@@ -22,181 +26,261 @@ import (
 const (
 	EmptyDirPrjIDAnnotation = "emptydir.terminus.io/project-id"
 	EmptyDirQuotaLabel      = "emptydir.terminus.io/quota"
+	EmptyDirInodeAnnotation = "emptydir.terminus.io/inodes"
+	EmptyDirSoftAnnotation  = "emptydir.terminus.io/soft-size"
+	EmptyDirGraceAnnotation = "emptydir.terminus.io/grace-period"
 )
 
 // EmptyDirHook 负责处理 emptydir
 type EmptyDirHook struct {
+	nri.BaseHook
 	kubeleRootPath string
 	store          *metadata.AsyncStore
 	kClient        kubernetes.Interface
+	allocator      *utils.ProjectIDAllocator
+	enforcement    *Enforcement
+	policies       *policy.Resolver
+	// sharedFilesystem 为 containerd 与 kubelet 目录是否位于同一文件系统，不在同一文件系统时不支持 Pod 级共享限额
+	sharedFilesystem bool
 }
 
-func NewEmptyDirHook(store *metadata.AsyncStore, kClient kubernetes.Interface, kubeletRootPath string) nri.Hook {
+func NewEmptyDirHook(store *metadata.AsyncStore, kClient kubernetes.Interface, kubeletRootPath string, allocator *utils.ProjectIDAllocator, enforcement *Enforcement, policies *policy.Resolver, sharedFilesystem bool) nri.Hook {
 	return &EmptyDirHook{
-		kubeleRootPath: kubeletRootPath,
-		store:          store,
-		kClient:        kClient,
+		kubeleRootPath:   kubeletRootPath,
+		store:            store,
+		kClient:          kClient,
+		allocator:        allocator,
+		enforcement:      enforcement,
+		policies:         policies,
+		sharedFilesystem: sharedFilesystem,
 	}
 }
 
 func (h *EmptyDirHook) Name() string { return "EmptyDirQuota" }
 
-func (h *EmptyDirHook) Process(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
+// RunPodSandbox 在 Pod 沙箱启动时为所有磁盘型 emptyDir 设置限额。
+// kubelet 在创建沙箱前已完成卷挂载，emptyDir 目录此时已经存在，容器启动前限额即已生效
+func (h *EmptyDirHook) RunPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
+	if err := h.setupPod(ctx, pod); err != nil {
+		return h.enforcement.FailPod(pod, err)
+	}
 	return nil
 }
 
-func (h *EmptyDirHook) Start(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
+// setupPod 按 Pod spec 中的 emptyDir 卷设置限额，重复执行是幂等的
+func (h *EmptyDirHook) setupPod(ctx context.Context, pod *api.PodSandbox) error {
 	podInfo, err := h.kClient.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
 	if err != nil {
-		klog.Error(err, "[emptyStorage] Failed to get pod info", "pod", pod.Name, "namespace", pod.Namespace)
+		return fmt.Errorf("failed to get pod info: %w", err)
+	}
+	if string(podInfo.UID) != pod.Uid {
+		return fmt.Errorf("pod %s/%s was recreated with uid %s", pod.Namespace, pod.Name, podInfo.UID)
 	}
 
-	foundEmptyVolume := false
-	var volumeName string
+	podLimit, shared, err := getPodLimit(podInfo.Annotations)
+	if err != nil {
+		return err
+	}
+	if shared {
+		return h.setupPodLevel(ctx, pod, podInfo, podLimit)
+	}
+
+	defaults := h.policies.Resolve(podInfo.Namespace, podInfo.Labels).EmptyDir
 
 	for _, volume := range podInfo.Spec.Volumes {
-		if volume.EmptyDir != nil && volume.EmptyDir.SizeLimit != nil && volume.EmptyDir.Medium != v1.StorageMediumMemory {
-			klog.Infof("[emptyStorage] Detected emptyDir volume: %s with size limit: %d bytes",
-				volume.Name, volume.EmptyDir.SizeLimit.Value())
-			foundEmptyVolume = true
-			volumeName = volume.Name
-			break
+		if volume.EmptyDir == nil {
+			continue
 		}
-	}
 
-	if !foundEmptyVolume {
-		klog.Errorf("[emptyStorage] %s pod not have empty dir ,skipping ", pod.Name)
-		return nil
-	}
+		if volume.EmptyDir.Medium == v1.StorageMediumMemory {
+			klog.V(4).Infof("[emptyStorage] emptyDir volume: %s is using memory medium, skipping quota setup", volume.Name)
+			continue
+		}
 
-	for _, m := range container.Mounts {
-		if strings.Contains(m.Source, "kubernetes.io~empty-dir") {
+		sizeLimit := volume.EmptyDir.SizeLimit
+		if sizeLimit == nil {
+			sizeLimit = defaults.DefaultSize
+		}
+		if sizeLimit == nil {
+			klog.V(4).Infof("[emptyStorage] emptyDir volume: %s does not have a size limit, skipping quota setup", volume.Name)
+			continue
+		}
 
-			klog.Infof("[emptyStorage] Detected container %s mounting emptyDir: %s at physical path: %s",
-				container.Name, volumeName, m.Source)
+		source := h.volumePath(pod.Uid, volume.Name)
+		if _, err := os.Stat(source); err != nil {
+			return fmt.Errorf("emptyDir %s is not mounted: %w", volume.Name, err)
+		}
 
-			limitBytes := uint64(0)
-			for _, volume := range podInfo.Spec.Volumes {
+		klog.Infof("[emptyStorage] Detected pod %s/%s emptyDir: %s at physical path: %s",
+			pod.Namespace, pod.Name, volume.Name, source)
 
-				if volume.EmptyDir.Medium == v1.StorageMediumMemory {
-					klog.Infof("[emptyStorage] emptyDir volume: %s is using memory medium, skipping quota setup", volume.Name)
-					continue
-				}
+		if err := h.applyVolumeQuota(ctx, pod, podInfo, volume.Name, source, uint64(sizeLimit.Value()), defaults); err != nil {
+			return err
+		}
+	}
 
-				if volume.EmptyDir.SizeLimit == nil {
-					klog.Infof("[emptyStorage] emptyDir volume: %s does not have a size limit, skipping quota setup", volume.Name)
-					continue
-				}
+	return nil
+}
 
-				// Check if the volume name matches the current mount point
+func (h *EmptyDirHook) volumePath(podUID, volumeName string) string {
+	return filepath.Join(h.kubeleRootPath, "pods", podUID, "volumes", "kubernetes.io~empty-dir", volumeName)
+}
 
-				if volume.Name == volumeName {
-					limitBytes = uint64(volume.EmptyDir.SizeLimit.Value())
-					break
-				}
-			}
+// applyVolumeQuota 为单个 emptyDir 卷设置 ProjectID 与限额，annotation 未声明 inode 限额时使用策略默认值。
+// 按 Pod UID 与卷名分配的 ProjectID 固定，限额已生效时直接返回
+func (h *EmptyDirHook) applyVolumeQuota(ctx context.Context, pod *api.PodSandbox, podInfo *v1.Pod, volumeName, source string, limitBytes uint64, defaults policy.StorageLimits) error {
+	limit := quotaLimit{bytes: limitBytes}
+	if defaults.DefaultInodes != nil {
+		limit.inodes = uint64(defaults.DefaultInodes.Value())
+	}
 
-			if limitBytes == 0 {
-				continue
-			}
+	if inodeStr, ok := containerAnnotation(podInfo.Annotations, EmptyDirInodeAnnotation, volumeName); ok {
+		q, err := resource.ParseQuantity(inodeStr)
+		if err != nil {
+			return fmt.Errorf("failed to parse inode limit %q for emptyDir %s: %w", inodeStr, volumeName, err)
+		}
+		limit.inodes = uint64(q.Value())
+	}
 
-			projectID, err := utils.GetProjectID()
-			if err != nil {
-				klog.ErrorS(err, "[emptyStorage] Failed to get project ID for emptyDir quota")
-				return nil
-			}
+	var err error
+	limit.softBytes, limit.grace, err = getSoftLimit(podInfo.Annotations, EmptyDirSoftAnnotation, EmptyDirGraceAnnotation, volumeName, limitBytes)
+	if err != nil {
+		return err
+	}
 
-			if err = terminus_quota.SetProjectIDRecursive(m.Source, projectID); err != nil {
-				klog.ErrorS(err, "[emptyStorage] Failed to set project ID for emptyDir quota", "path", m.Source, "projectID", projectID)
-				return nil
-			}
+	projectID, err := h.allocator.Allocate(metadata.EMPTYDIR_TYPE, utils.EmptyDirOwner(pod.Uid, volumeName))
+	if err != nil {
+		return fmt.Errorf("failed to get project ID for emptyDir quota: %w", err)
+	}
 
-			if err = terminus_quota.SetQuota(m.Source, uint32(projectID), terminus_quota.ProjQuota, limitBytes/KB, 0, 0, 0); err != nil {
-				klog.ErrorS(err, "[emptyStorage] Failed to set quota for emptyDir", "path", m.Source, "projectID", projectID, "limitBytes", limitBytes)
-				return nil
-			}
+	if id, err := terminus_quota.GetProjectID(source); err == nil && uint32(id) == projectID && quotaApplied(source, projectID, limit) {
+		klog.V(4).Infof("[emptyStorage] Quota for emptyDir %s already applied, projectID: %d", source, projectID)
+		return nil
+	}
 
-			h.store.TriggerUpdate(uint32(projectID), metadata.ContainerInfo{
-				ProjectID:     uint32(projectID),
-				Namespace:     pod.GetNamespace(),
-				PodName:       pod.GetName(),
-				ContainerName: container.GetName(),
-				VolumeName:    volumeName,
-				StorageType:   metadata.EMPTYDIR_TYPE,
-			})
-
-			if err := h.handleUpdatePod(ctx, pod.Name, pod.Namespace, volumeName, fmt.Sprintf("%d", uint32(projectID))); err != nil {
-				klog.Warningf("[emptyStorage]  %s/%s pod label update failed, It may affect the reporting of pod disk monitoring metrics, err: %v",
-					pod.Namespace, pod.Name, err)
-			}
+	if err = terminus_quota.SetProjectIDRecursive(source, int(projectID)); err != nil {
+		return fmt.Errorf("failed to set project ID %d for emptyDir %s: %w", projectID, source, err)
+	}
 
-			klog.Infof("[emptyStorage] Successfully set quota for emptyDir: %s, projectID: %d, limitBytes: %d",
-				m.Source, projectID, limitBytes)
-		}
+	if err = terminus_quota.SetQuota(source, projectID, terminus_quota.ProjQuota, limit.bytes/KB, limit.softBytes/KB, limit.inodes, 0); err != nil {
+		return fmt.Errorf("failed to set quota for emptyDir %s: %w", source, err)
 	}
 
+	h.store.TriggerUpdate(projectID, metadata.ContainerInfo{
+		ProjectID:   projectID,
+		Namespace:   pod.GetNamespace(),
+		PodName:     pod.GetName(),
+		VolumeName:  volumeName,
+		StorageType: metadata.EMPTYDIR_TYPE,
+		GracePeriod: limit.grace,
+	})
+
+	if err := h.handleUpdatePod(ctx, pod.Name, pod.Namespace, volumeName, fmt.Sprintf("%d", projectID)); err != nil {
+		klog.Warningf("[emptyStorage]  %s/%s pod label update failed, It may affect the reporting of pod disk monitoring metrics, err: %v",
+			pod.Namespace, pod.Name, err)
+	}
+
+	klog.Infof("[emptyStorage] Successfully set quota for emptyDir: %s, projectID: %d, limitBytes: %d, inodeLimit: %d",
+		source, projectID, limit.bytes, limit.inodes)
 	return nil
 }
 
-func (h *EmptyDirHook) Stop(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
+// RemovePodSandbox 在 Pod 沙箱删除时移除该 Pod 所有 emptyDir 的限额。
+// emptyDir 由 Pod 内所有容器共享，单个容器停止或删除时不能清理
+func (h *EmptyDirHook) RemovePodSandbox(ctx context.Context, pod *api.PodSandbox) error {
+	// 单个卷清理失败不影响其他卷，失败的 ProjectID 保留在分配器中，由 GC 回收
+	var errs []error
 
-	podInfo, err := h.kClient.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	projectID, shared, err := removePodQuota(h.allocator, pod, h.kubeleRootPath)
 	if err != nil {
-		klog.Error(err, "[emptyStorage] Failed to get pod info", "pod", pod.Name, "namespace", pod.Namespace)
+		klog.Warningf("[emptyStorage] remove pod quota for %s/%s, failed: %v", pod.Namespace, pod.Name, err)
+		errs = append(errs, err)
+	} else if shared {
+		h.store.TriggerDelete(projectID)
+		h.allocator.Release(projectID)
+		klog.Infof("[emptyStorage] Successfully remove pod quota for %s/%s, projectID: %d", pod.Namespace, pod.Name, projectID)
 	}
 
-	value, ok := podInfo.Labels[EmptyDirQuotaLabel]
-	if !ok || value != "enabled" {
-		klog.Infof("[emptyStorage] Pod %s/%s does not have emptyDir quota enabled, skipping cleanup", pod.Namespace, pod.Name)
-		return nil
-	}
+	for owner, projectID := range h.allocator.LookupPrefix(pod.Uid + "/") {
+		volumeName := strings.TrimPrefix(owner, pod.Uid+"/")
+		volumePath := h.volumePath(pod.Uid, volumeName)
 
-	foundEmptyVolume := false
-	var volumeName string
-	for _, volume := range podInfo.Spec.Volumes {
-		if volume.EmptyDir != nil && volume.EmptyDir.SizeLimit != nil {
-			klog.Infof("[emptyStorage] Detected emptyDir volume: %s with size limit: %d bytes",
-				volume.Name, volume.EmptyDir.SizeLimit.Value())
-			foundEmptyVolume = true
-			volumeName = volume.Name
-			break
+		if err := terminus_quota.RemoveQuota(h.kubeleRootPath, projectID, terminus_quota.ProjQuota); err != nil {
+			klog.Warningf("[emptyStorage] remove Project ID quota for %s, failed: %v", volumePath, err)
+			errs = append(errs, err)
+			continue
+		}
+
+		if _, err := os.Stat(volumePath); err == nil {
+			if err := terminus_quota.ClearProjectID(volumePath); err != nil {
+				klog.Warningf("[emptyStorage] clear Project ID for %s, failed", volumePath)
+			}
 		}
+
+		h.store.TriggerDelete(projectID)
+		h.allocator.Release(projectID)
+
+		klog.Infof("[emptyStorage] Successfully remove quota for emptyDir: %s, projectID: %d",
+			volumePath, projectID)
 	}
 
-	if !foundEmptyVolume {
-		klog.Errorf("[emptyStorage] %s pod not have empty dir ,skipping ", pod.Name)
-		return nil
+	return errors.Join(errs...)
+}
+
+// setupPodLevel 将 Pod 的所有磁盘型 emptyDir 加入 Pod 级共享 ProjectID
+func (h *EmptyDirHook) setupPodLevel(ctx context.Context, pod *api.PodSandbox, podInfo *v1.Pod, limitBytes uint64) error {
+	projectID, err := applyPodQuota(h.allocator, h.store, pod, h.kubeleRootPath, limitBytes, h.sharedFilesystem)
+	if err != nil {
+		return err
 	}
 
-	for _, m := range container.Mounts {
-		if strings.Contains(m.Source, "kubernetes.io~empty-dir") {
+	for _, volume := range podInfo.Spec.Volumes {
+		if !isDiskEmptyDir(podInfo, volume.Name) {
+			continue
+		}
 
-			klog.Infof("[emptyStorage] Detected container %s mounting emptyDir: %s at physical path: %s",
-				container.Name, volumeName, m.Source)
+		source := h.volumePath(pod.Uid, volume.Name)
+		if id, err := terminus_quota.GetProjectID(source); err == nil && uint32(id) == projectID {
+			continue
+		}
 
-			projectID, err := strconv.ParseUint(
-				podInfo.Annotations[fmt.Sprintf("%s.%s", EmptyDirPrjIDAnnotation, volumeName)], 10, 32)
-			if err != nil {
-				klog.Errorf("[emptyStorage] transform emptydir project id failed : %v\n %s\n", err, fmt.Sprintf("%s.%s", EmptyDirPrjIDAnnotation, container.Name))
-				return nil
-			}
+		if err := terminus_quota.SetProjectIDRecursive(source, int(projectID)); err != nil {
+			return fmt.Errorf("failed to set project ID %d for emptyDir %s: %w", projectID, source, err)
+		}
 
-			if err := terminus_quota.RemoveQuota(h.kubeleRootPath, uint32(projectID), terminus_quota.ProjQuota); err != nil {
-				klog.Warningf("[emptyStorage] remove Project ID quota for %s, failed", m.Source)
-				return err
-			}
+		if err := h.handleUpdatePod(ctx, pod.Name, pod.Namespace, volume.Name, fmt.Sprintf("%d", projectID)); err != nil {
+			klog.Warningf("[emptyStorage]  %s/%s pod label update failed, It may affect the reporting of pod disk monitoring metrics, err: %v",
+				pod.Namespace, pod.Name, err)
+		}
 
-			if err = terminus_quota.ClearProjectID(h.kubeleRootPath); err != nil {
-				klog.Warningf("[emptyStorage] clear Project ID for %s, failed", m.Source)
-			}
+		klog.Infof("[emptyStorage] Joined emptyDir %s to pod quota, projectID: %d, limitBytes: %d", source, projectID, limitBytes)
+	}
 
-			h.store.TriggerDelete(uint32(projectID))
+	return nil
+}
 
-			klog.Infof("[emptyStorage] Successfully remove quota for emptyDir: %s, projectID: %d",
-				m.Source, projectID)
+// isDiskEmptyDir 判断卷是否为磁盘型 emptyDir
+func isDiskEmptyDir(podInfo *v1.Pod, volumeName string) bool {
+	for _, volume := range podInfo.Spec.Volumes {
+		if volume.Name == volumeName {
+			return volume.EmptyDir != nil && volume.EmptyDir.Medium != v1.StorageMediumMemory
 		}
 	}
+	return false
+}
 
+// Synchronize 在 enforcer 重启后为所有存活 Pod 的 emptyDir 重新确认限额。
+// ProjectID 按 Pod UID 与卷名从分配器中取回，重复执行不会分配新的 ID
+func (h *EmptyDirHook) Synchronize(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container) error {
+	for _, pod := range pods {
+		if _, err := os.Stat(filepath.Join(h.kubeleRootPath, "pods", pod.Uid, "volumes", "kubernetes.io~empty-dir")); err != nil {
+			continue
+		}
+
+		if err := h.setupPod(ctx, pod); err != nil {
+			klog.ErrorS(err, "[emptyStorage] Failed to synchronize emptyDir quota", "pod", pod.Name, "namespace", pod.Namespace)
+		}
+	}
 	return nil
 }
 
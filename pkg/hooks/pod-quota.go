@@ -0,0 +1,72 @@
+package hooks
+
+import (
+	"fmt"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/terminus-io/Terminus/pkg/metadata"
+	"github.com/terminus-io/Terminus/pkg/utils"
+	terminus_quota "github.com/terminus-io/quota"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+)
+
+// PodSizeAnnotation 让 Pod 内所有容器可写层与磁盘型 emptyDir 共享一个 ProjectID 与一个限额，
+// 设置后容器级与 emptyDir 级的限额不再生效
+const PodSizeAnnotation = "storage.terminus.io/pod-size"
+
+// getPodLimit 读取 Pod 级共享限额
+func getPodLimit(annotations map[string]string) (uint64, bool, error) {
+	sizeStr, ok := annotations[PodSizeAnnotation]
+	if !ok {
+		return 0, false, nil
+	}
+
+	q, err := resource.ParseQuantity(sizeStr)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to parse pod limit %q: %w", sizeStr, err)
+	}
+	return uint64(q.Value()), true, nil
+}
+
+// applyPodQuota 为 Pod 分配共享 ProjectID，并在 mountPoint 所在文件系统上设置限额，重复设置是幂等的。
+// ProjectID 的用量按文件系统分别统计，containerd 与 kubelet 目录不在同一文件系统时两边各得到一份完整限额，
+// Pod 实际可用量会翻倍，因此拒绝设置，由执行策略决定是否放行
+func applyPodQuota(allocator *utils.ProjectIDAllocator, store *metadata.AsyncStore, pod *api.PodSandbox, mountPoint string, limitBytes uint64, sharedFilesystem bool) (uint32, error) {
+	if !sharedFilesystem {
+		return 0, fmt.Errorf("%s requires the containerd and kubelet root directories on the same filesystem", PodSizeAnnotation)
+	}
+
+	projectID, err := allocator.Allocate(metadata.POD_TYPE, utils.PodOwner(pod.Uid))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get project ID for pod quota: %w", err)
+	}
+
+	if err := terminus_quota.SetQuota(mountPoint, projectID, terminus_quota.ProjQuota, limitBytes/KB, 0, 0, 0); err != nil {
+		return 0, fmt.Errorf("failed to set pod quota on %s: %w", mountPoint, err)
+	}
+
+	store.TriggerUpdate(projectID, metadata.ContainerInfo{
+		ProjectID:   projectID,
+		Namespace:   pod.Namespace,
+		PodName:     pod.Name,
+		VolumeName:  "pod",
+		StorageType: metadata.POD_TYPE,
+	})
+
+	klog.V(2).InfoS("Pod quota applied", "pod", pod.Name, "namespace", pod.Namespace, "projectID", projectID, "limitBytes", limitBytes, "mountPoint", mountPoint)
+	return projectID, nil
+}
+
+// removePodQuota 移除 mountPoint 所在文件系统上的 Pod 级限额，Pod 未使用共享限额时返回 false
+func removePodQuota(allocator *utils.ProjectIDAllocator, pod *api.PodSandbox, mountPoint string) (uint32, bool, error) {
+	projectID, ok := allocator.Lookup(utils.PodOwner(pod.Uid))
+	if !ok {
+		return 0, false, nil
+	}
+
+	if err := terminus_quota.RemoveQuota(mountPoint, projectID, terminus_quota.ProjQuota); err != nil {
+		return projectID, true, fmt.Errorf("failed to remove pod quota %d on %s: %w", projectID, mountPoint, err)
+	}
+	return projectID, true, nil
+}
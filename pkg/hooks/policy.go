@@ -0,0 +1,101 @@
+package hooks
+
+import (
+	"fmt"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/terminus-io/Terminus/pkg/k8s"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+const (
+	EnforcementPolicyAnnotation  = "storage.terminus.io/enforcement-policy"
+	ReasonQuotaEnforcementFailed = "QuotaEnforcementFailed"
+)
+
+// EnforcementPolicy 决定 quota 无法生效时容器是否允许继续创建/启动
+type EnforcementPolicy string
+
+const (
+	// FailOpen 记录错误后放行容器，限额不生效
+	FailOpen EnforcementPolicy = "fail-open"
+	// FailClosed 向 NRI 返回错误，由 containerd 拒绝创建或启动容器
+	FailClosed EnforcementPolicy = "fail-closed"
+)
+
+func ParseEnforcementPolicy(s string) (EnforcementPolicy, error) {
+	switch EnforcementPolicy(s) {
+	case FailOpen, FailClosed:
+		return EnforcementPolicy(s), nil
+	case "":
+		return FailOpen, nil
+	}
+	return "", fmt.Errorf("unknown enforcement policy %q, must be %s or %s", s, FailOpen, FailClosed)
+}
+
+// Enforcement 由所有 Hook 共享，按全局策略与 Pod annotation 处理限额失败
+type Enforcement struct {
+	policy   EnforcementPolicy
+	recorder record.EventRecorder
+}
+
+func NewEnforcement(policy EnforcementPolicy, recorder record.EventRecorder) *Enforcement {
+	return &Enforcement{
+		policy:   policy,
+		recorder: recorder,
+	}
+}
+
+// PolicyFor 返回 Pod 生效的策略。annotation 只能让策略更严格：
+// 全局为 fail-open 时 Pod 可以选择 fail-closed，全局为 fail-closed 时忽略 Pod 的 fail-open，避免租户绕过集群配置
+func (e *Enforcement) PolicyFor(pod *api.PodSandbox) EnforcementPolicy {
+	val, ok := pod.GetAnnotations()[EnforcementPolicyAnnotation]
+	if !ok {
+		return e.policy
+	}
+
+	policy, err := ParseEnforcementPolicy(val)
+	if err != nil {
+		klog.Warningf("Pod %s/%s has invalid %s annotation %q, using %s", pod.Namespace, pod.Name, EnforcementPolicyAnnotation, val, e.policy)
+		return e.policy
+	}
+	if policy == FailOpen && e.policy == FailClosed {
+		klog.Warningf("Pod %s/%s requests %s but the node policy is %s, overrides may only be stricter", pod.Namespace, pod.Name, FailOpen, FailClosed)
+		return e.policy
+	}
+	return policy
+}
+
+// Fail 处理一次限额失败：fail-open 时只记录日志并返回 nil，fail-closed 时记录 Pod Event 并返回错误
+func (e *Enforcement) Fail(pod *api.PodSandbox, container *api.Container, err error) error {
+	policy := e.PolicyFor(pod)
+	if policy == FailOpen {
+		klog.ErrorS(err, "Quota not enforced, container allowed by fail-open policy", "pod", pod.Name, "namespace", pod.Namespace, "container", container.Name)
+		return nil
+	}
+
+	klog.ErrorS(err, "Quota not enforced, container rejected by fail-closed policy", "pod", pod.Name, "namespace", pod.Namespace, "container", container.Name)
+	if e.recorder != nil {
+		e.recorder.Eventf(k8s.PodReference(pod.Namespace, pod.Name, pod.Uid), v1.EventTypeWarning, ReasonQuotaEnforcementFailed,
+			"Container %s rejected by %s policy: %v", container.Name, policy, err)
+	}
+	return fmt.Errorf("terminus quota for container %s not enforced: %w", container.Name, err)
+}
+
+// FailPod 处理 Pod 沙箱级别的限额失败，fail-closed 时由 containerd 拒绝启动沙箱
+func (e *Enforcement) FailPod(pod *api.PodSandbox, err error) error {
+	policy := e.PolicyFor(pod)
+	if policy == FailOpen {
+		klog.ErrorS(err, "Quota not enforced, pod sandbox allowed by fail-open policy", "pod", pod.Name, "namespace", pod.Namespace)
+		return nil
+	}
+
+	klog.ErrorS(err, "Quota not enforced, pod sandbox rejected by fail-closed policy", "pod", pod.Name, "namespace", pod.Namespace)
+	if e.recorder != nil {
+		e.recorder.Eventf(k8s.PodReference(pod.Namespace, pod.Name, pod.Uid), v1.EventTypeWarning, ReasonQuotaEnforcementFailed,
+			"Pod sandbox rejected by %s policy: %v", policy, err)
+	}
+	return fmt.Errorf("terminus quota for pod %s/%s not enforced: %w", pod.Namespace, pod.Name, err)
+}
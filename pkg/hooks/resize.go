@@ -0,0 +1,242 @@
+package hooks
+
+import (
+	"context"
+	"strings"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/terminus-io/Terminus/pkg/k8s"
+	"github.com/terminus-io/Terminus/pkg/metadata"
+	"github.com/terminus-io/Terminus/pkg/nri"
+	"github.com/terminus-io/Terminus/pkg/utils"
+	terminus_quota "github.com/terminus-io/quota"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ReasonQuotaResized       = "QuotaResized"
+	ReasonQuotaResizeRefused = "QuotaResizeRefused"
+)
+
+// QuotaResizer 在限额 annotation 或 ephemeral-storage limit 变化时在线调整运行中容器的 rootfs quota
+type QuotaResizer struct {
+	nri.BaseHook
+	containerdRootPath string
+	store              *metadata.AsyncStore
+	kClient            kubernetes.Interface
+	allocator          *utils.ProjectIDAllocator
+	recorder           record.EventRecorder
+}
+
+func NewQuotaResizer(store *metadata.AsyncStore, kClient kubernetes.Interface, containerdRootPath string, allocator *utils.ProjectIDAllocator, recorder record.EventRecorder) *QuotaResizer {
+	return &QuotaResizer{
+		containerdRootPath: containerdRootPath,
+		store:              store,
+		kClient:            kClient,
+		allocator:          allocator,
+		recorder:           recorder,
+	}
+}
+
+func (r *QuotaResizer) Name() string { return "QuotaResize" }
+
+// Run 监听本节点 Pod 的限额 annotation 变化，直到 ctx 结束
+func (r *QuotaResizer) Run(ctx context.Context, nodeName string) {
+	klog.InfoS("Starting quota resizer", "node", nodeName)
+
+	factory := informers.NewSharedInformerFactoryWithOptions(r.kClient, 0,
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", nodeName).String()
+		}))
+
+	informer := factory.Core().V1().Pods().Informer()
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, ok := oldObj.(*v1.Pod)
+			if !ok {
+				return
+			}
+			newPod, ok := newObj.(*v1.Pod)
+			if !ok {
+				return
+			}
+			r.onPodUpdate(oldPod, newPod)
+		},
+	})
+	if err != nil {
+		klog.ErrorS(err, "Failed to add pod event handler, live quota resize disabled")
+		return
+	}
+
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+	<-ctx.Done()
+	factory.Shutdown()
+	klog.Info("Quota resizer stopped")
+}
+
+// UpdateContainer 处理 in-place resize，限额的优先级与创建时一致，见 containerQuotaLimit
+func (r *QuotaResizer) UpdateContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container, resources *api.LinuxResources) error {
+	podInfo, err := r.kClient.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		klog.ErrorS(err, "Failed to get pod for container update", "pod", pod.Name, "namespace", pod.Namespace, "container", container.Name)
+		return nil
+	}
+
+	limit, ok, err := containerQuotaLimit(podInfo, podInfo.Annotations, container.Name)
+	if err != nil {
+		klog.ErrorS(err, "Invalid quota annotation, skipping resize", "pod", pod.Name, "namespace", pod.Namespace, "container", container.Name)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+
+	r.resize(podInfo, container.Name, container.Id, limit)
+	return nil
+}
+
+// onPodUpdate 只调整自身限额发生变化的运行中容器
+func (r *QuotaResizer) onPodUpdate(oldPod, newPod *v1.Pod) {
+	if newPod.DeletionTimestamp != nil {
+		return
+	}
+
+	statuses := append(append([]v1.ContainerStatus{}, newPod.Status.InitContainerStatuses...), newPod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.State.Running == nil || status.ContainerID == "" {
+			continue
+		}
+
+		newLimit, ok, err := containerQuotaLimit(newPod, newPod.Annotations, status.Name)
+		if err != nil {
+			klog.ErrorS(err, "Invalid quota annotation, skipping resize", "pod", newPod.Name, "namespace", newPod.Namespace, "container", status.Name)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		oldLimit, _, _ := containerQuotaLimit(oldPod, oldPod.Annotations, status.Name)
+		if oldLimit == newLimit {
+			continue
+		}
+
+		r.resize(newPod, status.Name, trimContainerID(status.ContainerID), newLimit)
+	}
+}
+
+// resize 将容器的 quota 调整为 limit，新的限制低于当前用量时拒绝调整并记录 Event
+func (r *QuotaResizer) resize(podInfo *v1.Pod, containerName, containerID string, limit quotaLimit) {
+	projectID, ok := r.allocator.Lookup(containerID)
+	if !ok {
+		klog.V(4).InfoS("Container has no managed quota, skipping resize", "pod", podInfo.Name, "namespace", podInfo.Namespace, "container", containerName)
+		return
+	}
+
+	current, err := terminus_quota.GetQuota(r.containerdRootPath, projectID, terminus_quota.ProjQuota)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get current quota", "projectID", projectID, "container", containerName)
+		return
+	}
+
+	if current.BlockHardLimit == limit.bytes/KB && current.InodeHardLimit == limit.inodes && current.BlockSoftLimit == limit.softBytes/KB {
+		return
+	}
+
+	ref := k8s.PodReference(podInfo.Namespace, podInfo.Name, string(podInfo.UID))
+
+	if limit.bytes != 0 && limit.bytes/KB < current.CurrentBlocks {
+		klog.Warningf("Refusing to shrink quota of container %s in %s/%s to %dKi, current usage is %dKi",
+			containerName, podInfo.Namespace, podInfo.Name, limit.bytes/KB, current.CurrentBlocks)
+		r.event(ref, v1.EventTypeWarning, ReasonQuotaResizeRefused,
+			"Container %s: new size limit %dKi is below current usage %dKi, keeping %dKi",
+			containerName, limit.bytes/KB, current.CurrentBlocks, current.BlockHardLimit)
+		return
+	}
+
+	if limit.inodes != 0 && limit.inodes < current.CurrentInodes {
+		klog.Warningf("Refusing to shrink inode quota of container %s in %s/%s to %d, current usage is %d",
+			containerName, podInfo.Namespace, podInfo.Name, limit.inodes, current.CurrentInodes)
+		r.event(ref, v1.EventTypeWarning, ReasonQuotaResizeRefused,
+			"Container %s: new inode limit %d is below current usage %d, keeping %d",
+			containerName, limit.inodes, current.CurrentInodes, current.InodeHardLimit)
+		return
+	}
+
+	if err := terminus_quota.SetQuota(r.containerdRootPath, projectID, terminus_quota.ProjQuota,
+		limit.bytes/KB, limit.softBytes/KB, limit.inodes, 0); err != nil {
+		klog.ErrorS(err, "Failed to resize quota", "projectID", projectID, "container", containerName)
+		return
+	}
+
+	if info, ok := r.store.Get(projectID); ok {
+		info.GracePeriod = limit.grace
+		r.store.TriggerUpdate(projectID, info)
+	}
+
+	klog.InfoS("Quota resized", "pod", podInfo.Name, "namespace", podInfo.Namespace, "container", containerName,
+		"projectID", projectID, "oldKi", current.BlockHardLimit, "newKi", limit.bytes/KB, "inodes", limit.inodes)
+	r.event(ref, v1.EventTypeNormal, ReasonQuotaResized,
+		"Container %s quota resized from %dKi to %dKi", containerName, current.BlockHardLimit, limit.bytes/KB)
+}
+
+func (r *QuotaResizer) event(ref *v1.ObjectReference, eventType, reason, messageFmt string, args ...interface{}) {
+	if r.recorder != nil {
+		r.recorder.Eventf(ref, eventType, reason, messageFmt, args...)
+	}
+}
+
+// ephemeralStorageLimit 返回 Pod spec 中容器的 ephemeral-storage limit
+// containerQuotaLimit 计算容器限额，创建与在线调整共用同一优先级：
+// size annotation 优先，未声明时使用 Pod spec 中的 ephemeral-storage limit。podInfo 为 nil 时只使用 annotation
+func containerQuotaLimit(podInfo *v1.Pod, annotations map[string]string, containerName string) (quotaLimit, bool, error) {
+	limit, ok, err := getQuotaLimit(annotations, containerName)
+	if err != nil {
+		return limit, false, err
+	}
+
+	if _, set := containerAnnotation(annotations, DiskAnnotation, containerName); set || podInfo == nil {
+		return limit, ok, nil
+	}
+
+	if bytes, found := ephemeralStorageLimit(podInfo, containerName); found {
+		limit.bytes = bytes
+		if limit.softBytes >= limit.bytes {
+			limit.softBytes, limit.grace = 0, 0
+		}
+		ok = true
+	}
+	return limit, ok, nil
+}
+
+func ephemeralStorageLimit(podInfo *v1.Pod, containerName string) (uint64, bool) {
+	containers := append(append([]v1.Container{}, podInfo.Spec.InitContainers...), podInfo.Spec.Containers...)
+	for _, c := range containers {
+		if c.Name != containerName {
+			continue
+		}
+		if q, ok := c.Resources.Limits[v1.ResourceEphemeralStorage]; ok {
+			return uint64(q.Value()), true
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// trimContainerID 去掉 containerStatus 中 "containerd://" 之类的运行时前缀
+func trimContainerID(id string) string {
+	if i := strings.Index(id, "://"); i >= 0 {
+		return id[i+3:]
+	}
+	return id
+}
+
+var _ nri.Hook = &QuotaResizer{}
@@ -0,0 +1,95 @@
+package hooks
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestContainerQuotaLimit(t *testing.T) {
+	pod := func(annotations map[string]string, limit string) *v1.Pod {
+		c := v1.Container{Name: "app"}
+		if limit != "" {
+			c.Resources.Limits = v1.ResourceList{v1.ResourceEphemeralStorage: resource.MustParse(limit)}
+		}
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Annotations: annotations},
+			Spec:       v1.PodSpec{Containers: []v1.Container{c}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		pod     *v1.Pod
+		noSpec  bool
+		want    quotaLimit
+		wantOK  bool
+		wantErr bool
+	}{
+		{
+			name:   "annotation wins over ephemeral-storage limit",
+			pod:    pod(map[string]string{DiskAnnotation + ".app": "2Gi"}, "1Gi"),
+			want:   quotaLimit{bytes: 2048 * MB},
+			wantOK: true,
+		},
+		{
+			name:   "pod level size annotation wins over ephemeral-storage limit",
+			pod:    pod(map[string]string{DiskAnnotation: "2Gi"}, "1Gi"),
+			want:   quotaLimit{bytes: 2048 * MB},
+			wantOK: true,
+		},
+		{
+			name:   "ephemeral-storage limit without annotation",
+			pod:    pod(nil, "1Gi"),
+			want:   quotaLimit{bytes: 1024 * MB},
+			wantOK: true,
+		},
+		{
+			name:   "ephemeral-storage limit keeps inode annotation",
+			pod:    pod(map[string]string{InodeAnnotation + ".app": "1000"}, "1Gi"),
+			want:   quotaLimit{bytes: 1024 * MB, inodes: 1000},
+			wantOK: true,
+		},
+		{
+			name:   "soft limit above ephemeral-storage limit is dropped",
+			pod:    pod(map[string]string{SoftSizeAnnotation + ".app": "2Gi"}, "1Gi"),
+			want:   quotaLimit{bytes: 1024 * MB},
+			wantOK: true,
+		},
+		{
+			name:   "spec ignored when the live pod is unavailable",
+			pod:    pod(nil, "1Gi"),
+			noSpec: true,
+		},
+		{
+			name: "no limit",
+			pod:  pod(nil, ""),
+		},
+		{
+			name:    "invalid annotation",
+			pod:     pod(map[string]string{DiskAnnotation + ".app": "lots"}, "1Gi"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podInfo := tt.pod
+			if tt.noSpec {
+				podInfo = nil
+			}
+			got, ok, err := containerQuotaLimit(podInfo, tt.pod.Annotations, "app")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("containerQuotaLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("containerQuotaLimit() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
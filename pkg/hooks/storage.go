@@ -9,14 +9,17 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/containerd/nri/pkg/api"
 	"github.com/terminus-io/Terminus/pkg/metadata"
 	"github.com/terminus-io/Terminus/pkg/nri"
+	"github.com/terminus-io/Terminus/pkg/policy"
 	"github.com/terminus-io/Terminus/pkg/utils"
 	terminus_quota "github.com/terminus-io/quota"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
@@ -27,325 +30,386 @@ const (
 	DiskAnnotation      = "storage.terminus.io/size"
 	ContainerdBasePath  = "/run/containerd/io.containerd.runtime.v2.task/k8s.io/"
 	SystemMountInfoFile = "/proc/1/mountinfo"
+	InodeAnnotation     = "storage.terminus.io/inodes"
+	SoftSizeAnnotation  = "storage.terminus.io/soft-size"
+	GraceAnnotation     = "storage.terminus.io/grace-period"
 	ProjectIDAnnotation = "storage.terminus.io/project-id"
 	quotaEnableLabel    = "storage.terminus.io/quota"
 	KB                  = 1024
 	MB                  = 1024 * KB
+
+	// EphemeralSizeAnnotation 为之后加入的临时容器的默认限额，由 quota injector 在 Pod 创建时写入
+	EphemeralSizeAnnotation = "storage.terminus.io/ephemeral-size"
 )
 
 // StorageHook 负责处理磁盘限额
 type StorageHook struct {
+	nri.BaseHook
 	containerdRootPath string
 	containerdClient   *utils.ContainerdClientWrapper
 	containerdCtx      context.Context
 	store              *metadata.AsyncStore
 	kClient            kubernetes.Interface
+	allocator          *utils.ProjectIDAllocator
+	enforcement        *Enforcement
+	policies           *policy.Resolver
+	// sharedFilesystem 为 containerd 与 kubelet 目录是否位于同一文件系统，不在同一文件系统时不支持 Pod 级共享限额
+	sharedFilesystem bool
+}
+
+// quotaLimit 描述一个 ProjectID 上的限额，0 表示不限制
+type quotaLimit struct {
+	bytes     uint64
+	inodes    uint64
+	softBytes uint64
+	grace     time.Duration
+}
+
+// rootfsTarget 描述容器可写层对应的 quota 目标
+type rootfsTarget struct {
+	projectID uint32
+	upperDir  string
+	workDir   string
 }
 
 // qm quota.QuotaManager,
-func NewStorageHook(store *metadata.AsyncStore, kClient kubernetes.Interface, containerdRootPath string, wrapper *utils.ContainerdClientWrapper, containerdCtx context.Context) nri.Hook {
+func NewStorageHook(store *metadata.AsyncStore, kClient kubernetes.Interface, containerdRootPath string, wrapper *utils.ContainerdClientWrapper, containerdCtx context.Context, allocator *utils.ProjectIDAllocator, enforcement *Enforcement, policies *policy.Resolver, sharedFilesystem bool) nri.Hook {
 	return &StorageHook{
 		containerdRootPath: containerdRootPath,
 		containerdClient:   wrapper,
 		containerdCtx:      containerdCtx,
 		store:              store,
 		kClient:            kClient,
+		allocator:          allocator,
+		enforcement:        enforcement,
+		policies:           policies,
+		sharedFilesystem:   sharedFilesystem,
 	}
 }
 
 func (h *StorageHook) Name() string { return "StorageQuota" }
 
+// Process 在 CreateContainer 阶段执行，容器进程启动前即完成 ProjectID 与 quota 的设置
 func (h *StorageHook) Process(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
-	return nil
-}
-
-func (h *StorageHook) Start(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
-
-	prefix := DiskAnnotation + "." + container.Name
-	limitStr, ok := pod.Annotations[prefix]
+	limit, shared, ok, err := h.desiredQuota(ctx, pod, container)
+	if err != nil {
+		return h.enforcement.Fail(pod, container, err)
+	}
 	if !ok {
-		limitStr, ok = pod.Annotations[DiskAnnotation]
-		if !ok {
-			return nil
-		}
+		return nil
 	}
 
-	q, err := resource.ParseQuantity(limitStr)
+	target, err := h.resolveSnapshotTarget(container)
 	if err != nil {
-		klog.ErrorS(err, "Failed to parse limit string", "limit", limitStr)
+		if h.enforcement.PolicyFor(pod) == FailClosed {
+			return h.enforcement.Fail(pod, container, err)
+		}
+		klog.ErrorS(err, "Failed to resolve writable layer at create, quota will be applied at start", "container", container.Name, "containerID", container.Id)
 		return nil
 	}
 
-	limitBytes := uint64(q.Value())
-
-	klog.InfoS("Parsed quota limit",
-		"raw", limitStr,
-		"bytes", limitBytes,
-	)
-
-	if pod.GetRuntimeHandler() == "io.containerd.kata.v2" || pod.GetRuntimeHandler() == "kata" {
+	if shared {
+		err = h.applyPodRootfs(ctx, pod, container, target, limit.bytes)
+	} else {
+		err = h.applyQuota(ctx, pod, container, target, limit)
+	}
+	if err != nil {
+		return h.enforcement.Fail(pod, container, err)
+	}
+	return nil
+}
 
-		klog.Infof("[kata-container] Start container %s (ID: %s)", container.Name, container.Id)
+// Start 只确认 CreateContainer 阶段设置的 quota 已生效，未生效时再补充设置
+func (h *StorageHook) Start(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
+	if err := h.ensureQuota(ctx, pod, container); err != nil {
+		return h.enforcement.Fail(pod, container, err)
+	}
+	return nil
+}
 
-		cont, err := h.containerdClient.LoadContainer(h.containerdCtx, container.Id)
-		if err != nil {
-			klog.ErrorS(err, "[kata-container] failed to load container", "containerID", container.Id)
-			return nil
-		}
+// Synchronize 在 enforcer 重启后校验所有存活容器的限额，缺失时重新设置，并以节点上的真实状态重建元数据
+func (h *StorageHook) Synchronize(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container) error {
+	podByID := make(map[string]*api.PodSandbox, len(pods))
+	for _, pod := range pods {
+		podByID[pod.Id] = pod
+	}
 
-		info, err := cont.Info(h.containerdCtx)
-		if err != nil {
-			klog.ErrorS(err, "[kata-container] failed to get container info", "containerID", container.Id)
-			return nil
+	for _, container := range containers {
+		if !isLiveContainer(container) {
+			continue
 		}
 
-		snapshotKey := info.SnapshotKey
-		if snapshotKey == "" {
-			klog.ErrorS(err, "[kata-container] container has no snapshot key", "containerID", container.Id)
-			return nil
+		pod, ok := podByID[container.PodSandboxId]
+		if !ok {
+			continue
 		}
 
-		snapshotterName := info.Snapshotter
-		if snapshotterName == "" {
-			klog.ErrorS(err, "[kata-container] container has no snapshotter", "containerID", container.Id)
-			return nil
+		if err := h.ensureQuota(ctx, pod, container); err != nil {
+			klog.ErrorS(err, "Failed to synchronize quota", "pod", pod.Name, "namespace", pod.Namespace, "container", container.Name)
 		}
+	}
+	return nil
+}
 
-		snapshotter := h.containerdClient.SnapshotService(snapshotterName)
-		if snapshotter == nil {
-			klog.ErrorS(err, "[kata-container] snapshotter not found", "snapshotterName", snapshotterName)
-			return nil
+// desiredQuota 计算容器期望的限额，shared 为 true 时 limit.bytes 是 Pod 级共享限额。
+// 优先级依次为 Pod 级共享限额、容器限额（见 containerQuotaLimit）、TerminusQuotaPolicy 的默认值
+func (h *StorageHook) desiredQuota(ctx context.Context, pod *api.PodSandbox, container *api.Container) (quotaLimit, bool, bool, error) {
+	if annotations, podInfo, ok := h.quotaAnnotations(ctx, pod, container); ok {
+		podLimit, shared, err := getPodLimit(annotations)
+		if err != nil {
+			return quotaLimit{}, false, false, err
 		}
 
-		mounts, err := snapshotter.Mounts(h.containerdCtx, snapshotKey)
+		limit, ok, err := containerQuotaLimit(podInfo, annotations, container.Name)
 		if err != nil {
-			klog.ErrorS(err, "[kata-container] failed to get mounts for snapshot", "snapshotKey", snapshotKey)
-			return nil
+			return quotaLimit{}, false, false, err
 		}
 
-		if len(mounts) == 0 {
-			klog.ErrorS(err, "[kata-container] no mounts returned for snapshot", "snapshotKey", snapshotKey)
-			return nil
+		if shared {
+			if ok {
+				klog.Warningf("Pod %s/%s sets %s, container limits for %s are ignored", pod.Namespace, pod.Name, PodSizeAnnotation, container.Name)
+			}
+			return quotaLimit{bytes: podLimit}, true, true, nil
 		}
+		if ok {
+			return limit, false, true, nil
+		}
+	}
 
-		for _, m := range mounts {
-
-			upperdir := findOptionValue(m.Options, "upperdir")
+	limit, ok := policyDefaults(h.policies.Resolve(pod.Namespace, pod.Labels).Rootfs)
+	if ok {
+		klog.V(4).InfoS("Using quota policy defaults", "pod", pod.Name, "namespace", pod.Namespace, "container", container.Name, "bytes", limit.bytes, "inodes", limit.inodes)
+	}
+	return limit, false, ok, nil
+}
 
-			if upperdir != "" {
-				klog.V(4).Infof("[kata-container] Writable upperdir: %s\n", upperdir)
-			}
-			workdir := findOptionValue(m.Options, "workdir")
+// ensureQuota 确认容器可写层上的限额与 annotation 一致，不一致时重新设置
+func (h *StorageHook) ensureQuota(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
+	limit, shared, ok, err := h.desiredQuota(ctx, pod, container)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
 
-			if workdir != "" {
-				klog.V(4).Infof("[kata-container] Workdir   : %s\n", workdir)
-			}
+	target, err := h.resolveTarget(container, isKataRuntime(pod))
+	if err != nil {
+		return fmt.Errorf("could not find physical path: %w", err)
+	}
 
-			snapshotIDStr := filepath.Base(filepath.Dir(workdir))
-			snapshotID, err := strconv.ParseUint(snapshotIDStr, 10, 32)
-			if err != nil {
-				klog.Errorf("[kata-container] failed to parse snapshot ID %q: %v", snapshotIDStr, err)
-			}
+	if shared {
+		return h.applyPodRootfs(ctx, pod, container, target, limit.bytes)
+	}
 
-			klog.V(2).Infof("[kata-container] Applying quota %d MB to container %s (ID: %s) at %s", limitBytes/MB, container.Name, container.Id, upperdir)
+	if quotaApplied(h.containerdRootPath, target.projectID, limit) {
+		klog.V(4).InfoS("Quota confirmed", "container", container.Name, "projectID", target.projectID, "bytes", limit.bytes, "inodes", limit.inodes)
+		if err := h.allocator.Claim(metadata.ROOTFS_TYPE, target.projectID, container.Id); err != nil {
+			return err
+		}
+		h.recordMetadata(pod, container, target, limit)
+		return nil
+	}
 
-			klog.V(2).Infof("[kata-container] Target Quota Path: %s, Quota ProjectID: %d", upperdir, int(snapshotID))
+	klog.Warningf("Quota for container %s (ID: %s) is missing or outdated, applying now", container.Name, container.Id)
+	return h.applyQuota(ctx, pod, container, target, limit)
+}
 
-			if err := terminus_quota.SetProjectID(upperdir, int(snapshotID)); err != nil {
-				klog.Errorf("[kata-container] Failed to set fs project id for %s: %v", upperdir, err)
-			}
+// RemoveContainer 在容器删除时移除限额。容器停止后可写层仍然保留并可能被重新启动，因此不在 StopContainer 中清理
+func (h *StorageHook) RemoveContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
 
-			klog.V(2).Infof("[kata-container] Target Quota Path: %s, Quota ProjectID: %d", workdir, int(snapshotID))
+	// Pod 级共享限额在 sandbox 删除时统一移除
+	if _, shared := pod.Annotations[PodSizeAnnotation]; shared {
+		return nil
+	}
 
-			if err := terminus_quota.SetProjectIDRecursive(workdir, int(snapshotID)); err != nil {
-				klog.Errorf("[kata-container] Failed to set work project id for %s: %v", workdir, err)
-			}
+	projectID, ok := h.allocator.Lookup(container.Id)
+	if !ok && !hasQuotaAnnotation(pod.Annotations, container.Name) {
+		return nil
+	}
 
-			if err := terminus_quota.SetQuota(h.containerdRootPath, uint32(snapshotID),
-				terminus_quota.ProjQuota, limitBytes/KB, 0, 0, 0); err != nil {
-				klog.Errorf("[kata-container] Failed to apply quota: %v", err)
-			}
+	klog.V(2).Infof("Deleting quota to container %s (ID: %s)", container.Name, container.Id)
 
-			h.store.TriggerUpdate(uint32(snapshotID), metadata.ContainerInfo{
-				ProjectID:     uint32(snapshotID),
-				Namespace:     pod.Namespace,
-				PodName:       pod.Name,
-				ContainerName: container.Name,
-				VolumeName:    "rootfs",
-				StorageType:   metadata.ROOTFS_TYPE,
-			})
-
-			if err := h.handleUpdatePod(ctx, pod.Name, pod.Namespace, container.Name, fmt.Sprintf("%d", uint32(snapshotID))); err != nil {
-				klog.Warningf("[kata-container] %s/%s pod label update failed, It may affect the reporting of pod disk monitoring metrics, err: %v",
-					pod.Namespace, pod.Name, err)
-			}
+	if !ok {
+		target, err := h.resolveTarget(container, isKataRuntime(pod))
+		if err != nil {
+			klog.Warningf("found Project ID for container %s, failed: %v", container.Id, err)
+			return err
 		}
-
-		return nil
+		projectID = target.projectID
 	}
 
-	rootfsPath := filepath.Join(ContainerdBasePath, container.Id, "rootfs")
-	runPath := filepath.Join(ContainerdBasePath, container.Id, "rootfs")
-	//Obtain the snapshot ID of overlays as the ProjectID of xfs_quota
-	snapshotID, foundPath, err := getOverlayPath(runPath)
-	if err == nil && foundPath != "" {
-		rootfsPath = foundPath
-	} else {
-		klog.Errorf("Could not find physical path for container %s", container.Id)
-		return nil
+	if err := terminus_quota.RemoveQuota(h.containerdRootPath, projectID, terminus_quota.ProjQuota); err != nil {
+		klog.Warningf("remove Project ID %d quota for container %s, failed", projectID, container.Id)
+		return err
 	}
 
-	klog.V(2).Infof("Applying quota %d MB to container %s (ID: %s) at %s", limitBytes/MB, container.Name, container.Id, rootfsPath)
+	if err := terminus_quota.ClearProjectID(h.containerdRootPath); err != nil {
+		klog.Warningf("clear Project ID %d for container %s, failed", projectID, container.Id)
+	}
 
-	klog.V(2).Infof("Target Quota Path: %s, Quota ProjectID: %v", rootfsPath, snapshotID)
+	h.store.TriggerDelete(projectID)
+	h.allocator.Release(projectID)
+	return nil
+}
 
-	if err := terminus_quota.SetProjectIDRecursive(rootfsPath, int(snapshotID)); err != nil {
-		klog.Errorf("Failed to set fs project id for %s: %v", rootfsPath, err)
+// RemovePodSandbox 移除 containerd 目录所在文件系统上的 Pod 级共享限额，
+// ProjectID 由随后执行的 EmptyDirHook 在 kubelet 目录上清理后释放
+func (h *StorageHook) RemovePodSandbox(ctx context.Context, pod *api.PodSandbox) error {
+	projectID, ok, err := removePodQuota(h.allocator, pod, h.containerdRootPath)
+	if err != nil {
+		klog.Warningf("remove pod quota for %s/%s, failed: %v", pod.Namespace, pod.Name, err)
+		return err
+	}
+	if ok {
+		klog.V(2).Infof("Removed pod quota %d of %s/%s on %s", projectID, pod.Namespace, pod.Name, h.containerdRootPath)
 	}
+	return nil
+}
 
-	workPath := strings.TrimSuffix(rootfsPath, "/fs") + "/work"
-	klog.V(2).Infof("Target Quota Path: %s, Quota ProjectID: %v", workPath, snapshotID)
-	if err := terminus_quota.SetProjectIDRecursive(workPath, int(snapshotID)); err != nil {
-		klog.Errorf("Failed to set work project id for %s: %v", workPath, err)
+// applyPodRootfs 将容器可写层加入 Pod 级共享 ProjectID
+func (h *StorageHook) applyPodRootfs(ctx context.Context, pod *api.PodSandbox, container *api.Container, target *rootfsTarget, limitBytes uint64) error {
+	projectID, err := applyPodQuota(h.allocator, h.store, pod, h.containerdRootPath, limitBytes, h.sharedFilesystem)
+	if err != nil {
+		return err
 	}
 
-	if err := terminus_quota.SetQuota(h.containerdRootPath, uint32(snapshotID),
-		terminus_quota.ProjQuota, limitBytes/KB, 0, 0, 0); err != nil {
-		klog.Errorf("Failed to apply quota: %v", err)
+	if id, err := terminus_quota.GetProjectID(target.upperDir); err == nil && uint32(id) == projectID {
+		klog.V(4).InfoS("Pod quota confirmed", "container", container.Name, "projectID", projectID)
+		return nil
 	}
 
-	h.store.TriggerUpdate(uint32(snapshotID), metadata.ContainerInfo{
-		ProjectID:     uint32(snapshotID),
-		Namespace:     pod.Namespace,
-		PodName:       pod.Name,
-		ContainerName: container.Name,
-		VolumeName:    "rootfs",
-		StorageType:   metadata.ROOTFS_TYPE,
-	})
+	klog.V(2).Infof("Joining container %s (ID: %s) to pod quota %d at %s", container.Name, container.Id, projectID, target.upperDir)
+	if err := terminus_quota.SetProjectIDRecursive(target.upperDir, int(projectID)); err != nil {
+		return fmt.Errorf("failed to set fs project id for %s: %w", target.upperDir, err)
+	}
+	if err := terminus_quota.SetProjectIDRecursive(target.workDir, int(projectID)); err != nil {
+		return fmt.Errorf("failed to set work project id for %s: %w", target.workDir, err)
+	}
 
-	if err := h.handleUpdatePod(ctx, pod.Name, pod.Namespace, container.Name, fmt.Sprintf("%d", uint32(snapshotID))); err != nil {
+	if err := h.handleUpdatePod(ctx, pod.Name, pod.Namespace, container.Name, fmt.Sprintf("%d", projectID)); err != nil {
 		klog.Warningf("%s/%s pod label update failed, It may affect the reporting of pod disk monitoring metrics, err: %v",
 			pod.Namespace, pod.Name, err)
 	}
 	return nil
 }
 
-func (h *StorageHook) Stop(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
+// applyQuota 为可写层设置 ProjectID 与 quota，并记录元数据
+func (h *StorageHook) applyQuota(ctx context.Context, pod *api.PodSandbox, container *api.Container, target *rootfsTarget, limit quotaLimit) error {
+	klog.V(2).Infof("Applying quota %d MB, %d inodes to container %s (ID: %s) at %s", limit.bytes/MB, limit.inodes, container.Name, container.Id, target.upperDir)
 
-	prefix := DiskAnnotation + "." + container.Name
-	_, ok := pod.Annotations[prefix]
-	if !ok {
-		_, ok = pod.Annotations[DiskAnnotation]
-		if !ok {
-			return nil
-		}
+	// snapshot ID 作为 ProjectID 前先登记，避免与其他存活卷共用同一个 ID
+	if err := h.allocator.Claim(metadata.ROOTFS_TYPE, target.projectID, container.Id); err != nil {
+		return err
 	}
 
-	if pod.GetRuntimeHandler() == "io.containerd.kata.v2" || pod.GetRuntimeHandler() == "kata" {
-		klog.Infof("[kata-container] Stop container %s (ID: %s)", container.Name, container.Id)
-
-		cont, err := h.containerdClient.LoadContainer(h.containerdCtx, container.Id)
-		if err != nil {
-			klog.ErrorS(err, "[kata-container] failed to load container", "containerID", container.Id)
-			return nil
-		}
-
-		info, err := cont.Info(h.containerdCtx)
-		if err != nil {
-			klog.ErrorS(err, "[kata-container] failed to get container info", "containerID", container.Id)
-			return nil
-		}
-
-		snapshotKey := info.SnapshotKey
-		if snapshotKey == "" {
-			klog.ErrorS(err, "[kata-container] container has no snapshot key", "containerID", container.Id)
-			return nil
-		}
-
-		snapshotterName := info.Snapshotter
-		if snapshotterName == "" {
-			klog.ErrorS(err, "[kata-container] container has no snapshotter", "containerID", container.Id)
-			return nil
-		}
-
-		snapshotter := h.containerdClient.SnapshotService(snapshotterName)
-		if snapshotter == nil {
-			klog.ErrorS(err, "[kata-container] snapshotter not found", "snapshotterName", snapshotterName)
-			return nil
-		}
-
-		mounts, err := snapshotter.Mounts(h.containerdCtx, snapshotKey)
-		if err != nil {
-			klog.ErrorS(err, "[kata-container] failed to get mounts for snapshot", "snapshotKey", snapshotKey)
-			return nil
-		}
-
-		if len(mounts) == 0 {
-			klog.ErrorS(err, "[kata-container] no mounts returned for snapshot", "snapshotKey", snapshotKey)
-			return nil
-		}
-
-		for _, m := range mounts {
+	klog.V(2).Infof("Target Quota Path: %s, Quota ProjectID: %v", target.upperDir, target.projectID)
+	if err := terminus_quota.SetProjectIDRecursive(target.upperDir, int(target.projectID)); err != nil {
+		return fmt.Errorf("failed to set fs project id for %s: %w", target.upperDir, err)
+	}
 
-			upperdir := findOptionValue(m.Options, "upperdir")
+	klog.V(2).Infof("Target Quota Path: %s, Quota ProjectID: %v", target.workDir, target.projectID)
+	if err := terminus_quota.SetProjectIDRecursive(target.workDir, int(target.projectID)); err != nil {
+		return fmt.Errorf("failed to set work project id for %s: %w", target.workDir, err)
+	}
 
-			if upperdir != "" {
-				klog.V(4).Infof("[kata-container] Writable upperdir: %s\n", upperdir)
-			}
-			workdir := findOptionValue(m.Options, "workdir")
+	if err := terminus_quota.SetQuota(h.containerdRootPath, target.projectID,
+		terminus_quota.ProjQuota, limit.bytes/KB, limit.softBytes/KB, limit.inodes, 0); err != nil {
+		return fmt.Errorf("failed to apply quota: %w", err)
+	}
 
-			if workdir != "" {
-				klog.V(4).Infof("[kata-container] Workdir   : %s\n", workdir)
-			}
+	h.recordMetadata(pod, container, target, limit)
 
-			snapshotIDStr := filepath.Base(filepath.Dir(workdir))
-			snapshotID, err := strconv.ParseUint(snapshotIDStr, 10, 32)
-			if err != nil {
-				klog.Errorf("[kata-container] failed to parse snapshot ID %q: %v", snapshotIDStr, err)
-			}
+	if err := h.handleUpdatePod(ctx, pod.Name, pod.Namespace, container.Name, fmt.Sprintf("%d", target.projectID)); err != nil {
+		klog.Warningf("%s/%s pod label update failed, It may affect the reporting of pod disk monitoring metrics, err: %v",
+			pod.Namespace, pod.Name, err)
+	}
+	return nil
+}
 
-			klog.V(2).Infof("[kata-container] Deleting quota to container %s (ID: %s) at %s", container.Name, container.Id, upperdir)
+func (h *StorageHook) recordMetadata(pod *api.PodSandbox, container *api.Container, target *rootfsTarget, limit quotaLimit) {
+	h.store.TriggerUpdate(target.projectID, metadata.ContainerInfo{
+		ProjectID:     target.projectID,
+		Namespace:     pod.Namespace,
+		PodName:       pod.Name,
+		ContainerName: container.Name,
+		VolumeName:    "rootfs",
+		StorageType:   metadata.ROOTFS_TYPE,
+		GracePeriod:   limit.grace,
+	})
+}
 
-			if err := terminus_quota.SetProjectID(upperdir, int(snapshotID)); err != nil {
-				klog.Errorf("[kata-container] Failed to set fs project id for %s: %v", upperdir, err)
-			}
+// resolveTarget 优先通过 containerd snapshot 解析可写层，runc 容器失败时回退到 mountinfo
+func (h *StorageHook) resolveTarget(container *api.Container, kata bool) (*rootfsTarget, error) {
+	target, err := h.resolveSnapshotTarget(container)
+	if err == nil || kata {
+		return target, err
+	}
 
-			klog.V(2).Infof("[kata-container] Target Quota Path: %s, Quota ProjectID: %d", workdir, int(snapshotID))
+	runPath := filepath.Join(ContainerdBasePath, container.Id, "rootfs")
+	snapshotID, foundPath, mErr := getOverlayPath(runPath)
+	if mErr != nil {
+		return nil, fmt.Errorf("snapshot: %v, mountinfo: %v", err, mErr)
+	}
 
-			if err := terminus_quota.RemoveQuota(h.containerdRootPath, uint32(snapshotID), terminus_quota.ProjQuota); err != nil {
-				klog.Warningf("[kata-container] remove Project ID quota for %s, failed", upperdir)
-				return err
-			}
+	return &rootfsTarget{
+		projectID: uint32(snapshotID),
+		upperDir:  foundPath,
+		workDir:   strings.TrimSuffix(foundPath, "/fs") + "/work",
+	}, nil
+}
 
-			if err := terminus_quota.ClearProjectID(h.containerdRootPath); err != nil {
-				klog.Warningf("[kata-container] clear Project ID for %s, failed", upperdir)
-			}
+// resolveSnapshotTarget 从容器的 snapshot 中解析可写层
+func (h *StorageHook) resolveSnapshotTarget(container *api.Container) (*rootfsTarget, error) {
+	layer, err := h.containerdClient.ResolveWritableLayer(h.containerdCtx, container.Id, container.PodSandboxId)
+	if err != nil {
+		return nil, err
+	}
 
-			h.store.TriggerDelete(uint32(snapshotID))
-		}
+	return &rootfsTarget{
+		projectID: layer.ProjectID,
+		upperDir:  layer.UpperDir,
+		workDir:   layer.WorkDir,
+	}, nil
+}
 
-		return nil
+// quotaAnnotations 返回计算容器限额使用的 annotation，没有任何限额声明时返回 false。
+// sandbox 中的 annotation 是创建时的快照，不包含之后在线调整的限额，因此优先读取 API Server 中的最新值。
+// 临时容器在 Pod 创建后才加入，无法声明 resources，未单独声明限额时使用 Pod 上的 ephemeral-size。
+// 读取成功时同时返回最新的 Pod，读取失败时为 nil
+func (h *StorageHook) quotaAnnotations(ctx context.Context, pod *api.PodSandbox, container *api.Container) (map[string]string, *v1.Pod, bool) {
+	_, ephemeral := pod.Annotations[EphemeralSizeAnnotation]
+	if !ephemeral && !hasQuotaAnnotation(pod.Annotations, container.Name) {
+		return nil, nil, false
 	}
 
-	rootfsPath := filepath.Join(ContainerdBasePath, container.Id, "rootfs")
-	klog.V(2).Infof("Deleting quota to container %s (ID: %s) at %s", container.Name, container.Id, rootfsPath)
-	snapshotID, foundPath, err := getOverlayPath(rootfsPath)
+	podInfo, err := h.kClient.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if err == nil && string(podInfo.UID) != pod.Uid {
+		err = fmt.Errorf("live pod UID %s does not match sandbox UID %s", podInfo.UID, pod.Uid)
+	}
 	if err != nil {
-		klog.Warningf("found Project ID for %s, failed", foundPath)
-		return err
+		// sandbox annotation 无法区分临时容器，ephemeral-size 不能用作回退，临时容器只能使用单独声明的限额
+		klog.ErrorS(err, "Failed to read live pod, using sandbox annotations without ephemeral-size fallback and in-place limit changes",
+			"pod", pod.Name, "namespace", pod.Namespace, "container", container.Name, "ephemeralSize", ephemeral)
+		return pod.Annotations, nil, hasQuotaAnnotation(pod.Annotations, container.Name)
 	}
 
-	if err := terminus_quota.RemoveQuota(h.containerdRootPath, uint32(snapshotID), terminus_quota.ProjQuota); err != nil {
-		klog.Warningf("remove Project ID quota for %s, failed", foundPath)
-		return err
+	annotations := podInfo.Annotations
+	if size, ok := annotations[EphemeralSizeAnnotation]; ok && isEphemeralContainer(podInfo, container.Name) {
+		if _, ok := containerAnnotation(annotations, DiskAnnotation, container.Name); !ok {
+			annotations[DiskAnnotation+"."+container.Name] = size
+		}
 	}
+	return annotations, podInfo, hasQuotaAnnotation(annotations, container.Name)
+}
 
-	if err := terminus_quota.ClearProjectID(h.containerdRootPath); err != nil {
-		klog.Warningf("clear Project ID for %s, failed", foundPath)
+func isEphemeralContainer(pod *v1.Pod, name string) bool {
+	for _, c := range pod.Spec.EphemeralContainers {
+		if c.Name == name {
+			return true
+		}
 	}
-
-	h.store.TriggerDelete(uint32(snapshotID))
-	return nil
+	return false
 }
 
 func (h *StorageHook) handleUpdatePod(ctx context.Context, podName, namespace, containerName, projectID string) error {
@@ -376,6 +440,136 @@ func (h *StorageHook) handleUpdatePod(ctx context.Context, podName, namespace, c
 	return err
 }
 
+// getQuotaLimit 读取容器的磁盘与 inode 限额，容器级 annotation 优先于 Pod 级
+func getQuotaLimit(annotations map[string]string, containerName string) (quotaLimit, bool, error) {
+	limit := quotaLimit{}
+	found := false
+
+	if limitStr, ok := containerAnnotation(annotations, DiskAnnotation, containerName); ok {
+		q, err := resource.ParseQuantity(limitStr)
+		if err != nil {
+			return limit, false, fmt.Errorf("failed to parse limit %q: %w", limitStr, err)
+		}
+		limit.bytes = uint64(q.Value())
+		found = true
+	}
+
+	if inodeStr, ok := containerAnnotation(annotations, InodeAnnotation, containerName); ok {
+		q, err := resource.ParseQuantity(inodeStr)
+		if err != nil {
+			return limit, false, fmt.Errorf("failed to parse inode limit %q: %w", inodeStr, err)
+		}
+		limit.inodes = uint64(q.Value())
+		found = true
+	}
+
+	if !found {
+		return limit, false, nil
+	}
+
+	var err error
+	limit.softBytes, limit.grace, err = getSoftLimit(annotations, SoftSizeAnnotation, GraceAnnotation, containerName, limit.bytes)
+	if err != nil {
+		return limit, false, err
+	}
+
+	klog.V(4).InfoS("Parsed quota limit",
+		"bytes", limit.bytes,
+		"inodes", limit.inodes,
+		"softBytes", limit.softBytes,
+		"grace", limit.grace,
+	)
+	return limit, true, nil
+}
+
+// policyDefaults 将策略中的默认值转换为限额，策略未设置默认值时返回 false
+func policyDefaults(l policy.StorageLimits) (quotaLimit, bool) {
+	limit := quotaLimit{}
+	if l.DefaultSize != nil {
+		limit.bytes = uint64(l.DefaultSize.Value())
+	}
+	if l.DefaultInodes != nil {
+		limit.inodes = uint64(l.DefaultInodes.Value())
+	}
+	return limit, limit.bytes != 0 || limit.inodes != 0
+}
+
+// getSoftLimit 读取软限制与宽限期，软限制必须小于硬限制，否则忽略。
+// 宽限期依次查找 graceKey.<name>、graceKey 与 Pod 级的 storage.terminus.io/grace-period
+func getSoftLimit(annotations map[string]string, softKey, graceKey, name string, hardBytes uint64) (uint64, time.Duration, error) {
+	softStr, ok := containerAnnotation(annotations, softKey, name)
+	if !ok {
+		return 0, 0, nil
+	}
+
+	q, err := resource.ParseQuantity(softStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse soft limit %q: %w", softStr, err)
+	}
+
+	softBytes := uint64(q.Value())
+	if hardBytes != 0 && softBytes >= hardBytes {
+		klog.Warningf("Soft limit %s for %s is not below the hard limit, ignoring", softStr, name)
+		return 0, 0, nil
+	}
+
+	graceStr, ok := containerAnnotation(annotations, graceKey, name)
+	if !ok {
+		graceStr, ok = annotations[GraceAnnotation]
+	}
+
+	var grace time.Duration
+	if ok {
+		grace, err = time.ParseDuration(graceStr)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to parse grace period %q: %w", graceStr, err)
+		}
+	}
+
+	return softBytes, grace, nil
+}
+
+// hasQuotaAnnotation 判断容器是否声明了任意 Terminus 限额
+func hasQuotaAnnotation(annotations map[string]string, containerName string) bool {
+	if _, ok := annotations[PodSizeAnnotation]; ok {
+		return true
+	}
+	if _, ok := containerAnnotation(annotations, DiskAnnotation, containerName); ok {
+		return true
+	}
+	_, ok := containerAnnotation(annotations, InodeAnnotation, containerName)
+	return ok
+}
+
+// containerAnnotation 先查找 key.<containerName>，不存在时回退到 Pod 级的 key
+func containerAnnotation(annotations map[string]string, key, containerName string) (string, bool) {
+	if val, ok := annotations[key+"."+containerName]; ok {
+		return val, true
+	}
+	val, ok := annotations[key]
+	return val, ok
+}
+
+// quotaApplied 判断 projectID 上的硬限制是否已经按预期设置
+func quotaApplied(path string, projectID uint32, limit quotaLimit) bool {
+	info, err := terminus_quota.GetQuota(path, projectID, terminus_quota.ProjQuota)
+	if err != nil {
+		return false
+	}
+	return info.BlockHardLimit == limit.bytes/KB && info.InodeHardLimit == limit.inodes &&
+		info.BlockSoftLimit == limit.softBytes/KB
+}
+
+// isLiveContainer 判断容器的可写层是否仍在使用
+func isLiveContainer(container *api.Container) bool {
+	return container.State == api.ContainerState_CONTAINER_CREATED || container.State == api.ContainerState_CONTAINER_RUNNING ||
+		container.State == api.ContainerState_CONTAINER_PAUSED
+}
+
+func isKataRuntime(pod *api.PodSandbox) bool {
+	return pod.GetRuntimeHandler() == "io.containerd.kata.v2" || pod.GetRuntimeHandler() == "kata"
+}
+
 func getOverlayPath(containerRootfs string) (uint64, string, error) {
 	f, err := os.Open(SystemMountInfoFile)
 	if err != nil {
@@ -426,13 +620,3 @@ func getOverlayPath(containerRootfs string) (uint64, string, error) {
 
 	return 0, "", fmt.Errorf("overlay path not found in mountinfo for %s", containerRootfs)
 }
-
-func findOptionValue(opts []string, key string) string {
-	prefix := key + "="
-	for _, opt := range opts {
-		if strings.HasPrefix(opt, prefix) {
-			return strings.TrimPrefix(opt, prefix)
-		}
-	}
-	return ""
-}
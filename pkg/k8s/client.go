@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -12,6 +13,29 @@ import (
 )
 
 func GenrateK8sClient() (*kubernetes.Clientset, error) {
+	config, err := restConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return clientset, nil
+}
+
+// GenrateDynamicClient 创建用于访问 CRD 的 dynamic client
+func GenrateDynamicClient() (dynamic.Interface, error) {
+	config, err := restConfig()
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(config)
+}
+
+func restConfig() (*rest.Config, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		klog.V(4).InfoS("InClusterConfig failed, trying local kubeconfig", "err", err)
@@ -30,10 +54,5 @@ func GenrateK8sClient() (*kubernetes.Clientset, error) {
 		}
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, err
-	}
-
-	return clientset, nil
+	return config, nil
 }
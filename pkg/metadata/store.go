@@ -2,7 +2,10 @@ package metadata
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -32,19 +35,35 @@ type UpdateEvent struct {
 	Info      ContainerInfo
 }
 
+// softLimitState 记录 ProjectID 超过软限制的时间，持久化到节点上，enforcer 重启后宽限期不会重新开始
+type softLimitState struct {
+	Since time.Time `json:"since"`
+	// Expired 为 true 表示已发出宽限期结束的 Event
+	Expired bool `json:"expired,omitempty"`
+}
+
 type AsyncStore struct {
-	data     map[uint32]ContainerInfo
-	mu       sync.RWMutex
-	updateCh chan UpdateEvent
-	kClient  kubernetes.Interface
+	data          map[uint32]ContainerInfo
+	softSince     map[uint32]softLimitState
+	softStatePath string
+	mu            sync.RWMutex
+	updateCh      chan UpdateEvent
+	kClient       kubernetes.Interface
 }
 
-func NewAsyncStore(bufferSize int, kclient kubernetes.Interface) *AsyncStore {
-	return &AsyncStore{
-		data:     make(map[uint32]ContainerInfo),
-		updateCh: make(chan UpdateEvent, bufferSize),
-		kClient:  kclient,
+// NewAsyncStore 创建元数据缓存，softStatePath 为空时软限制状态只保存在内存中
+func NewAsyncStore(bufferSize int, kclient kubernetes.Interface, softStatePath string) (*AsyncStore, error) {
+	s := &AsyncStore{
+		data:          make(map[uint32]ContainerInfo),
+		softSince:     make(map[uint32]softLimitState),
+		softStatePath: softStatePath,
+		updateCh:      make(chan UpdateEvent, bufferSize),
+		kClient:       kclient,
+	}
+	if err := s.loadSoftLimitState(); err != nil {
+		return nil, err
 	}
+	return s, nil
 }
 
 func (s *AsyncStore) TriggerUpdate(id uint32, info ContainerInfo) {
@@ -88,6 +107,10 @@ func (s *AsyncStore) handleEvent(e UpdateEvent) {
 
 	case EventDelete:
 		delete(s.data, e.ProjectID)
+		if _, ok := s.softSince[e.ProjectID]; ok {
+			delete(s.softSince, e.ProjectID)
+			s.saveSoftLimitStateLocked()
+		}
 		klog.V(4).InfoS("Async deleted metadata", "id", e.ProjectID)
 	}
 }
@@ -99,6 +122,92 @@ func (s *AsyncStore) Get(id uint32) (ContainerInfo, bool) {
 	return val, ok
 }
 
+// MarkSoftLimitExceeded 记录 ProjectID 首次超过软限制的时间，返回是否为首次记录
+func (s *AsyncStore) MarkSoftLimitExceeded(id uint32, now time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.softSince[id]; ok {
+		return state.Since, false
+	}
+	s.softSince[id] = softLimitState{Since: now}
+	s.saveSoftLimitStateLocked()
+	return now, true
+}
+
+// MarkGraceExpired 记录宽限期已结束，返回是否为首次记录
+func (s *AsyncStore) MarkGraceExpired(id uint32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.softSince[id]
+	if !ok || state.Expired {
+		return false
+	}
+	state.Expired = true
+	s.softSince[id] = state
+	s.saveSoftLimitStateLocked()
+	return true
+}
+
+// ClearSoftLimitExceeded 在用量回落到软限制以下时清除记录
+func (s *AsyncStore) ClearSoftLimitExceeded(id uint32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.softSince[id]; !ok {
+		return false
+	}
+	delete(s.softSince, id)
+	s.saveSoftLimitStateLocked()
+	return true
+}
+
+// SoftLimitExceededSince 返回 ProjectID 开始超过软限制的时间
+func (s *AsyncStore) SoftLimitExceededSince(id uint32) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state, ok := s.softSince[id]
+	return state.Since, ok
+}
+
+func (s *AsyncStore) loadSoftLimitState() error {
+	if s.softStatePath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.softStatePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read soft limit state %s: %w", s.softStatePath, err)
+	}
+	if err := json.Unmarshal(data, &s.softSince); err != nil {
+		return fmt.Errorf("failed to decode soft limit state %s: %w", s.softStatePath, err)
+	}
+	klog.InfoS("Loaded soft limit state", "path", s.softStatePath, "exceeded", len(s.softSince))
+	return nil
+}
+
+// saveSoftLimitStateLocked 先写临时文件再 rename，写入失败只记录日志，状态仍保留在内存中
+func (s *AsyncStore) saveSoftLimitStateLocked() {
+	if s.softStatePath == "" {
+		return
+	}
+
+	data, err := json.Marshal(s.softSince)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(s.softStatePath), 0o755)
+	}
+	if err == nil {
+		tmp := s.softStatePath + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, s.softStatePath)
+		}
+	}
+	if err != nil {
+		klog.ErrorS(err, "Failed to persist soft limit state", "path", s.softStatePath)
+	}
+}
+
 func (s *AsyncStore) TriggerRestore() {
 	nodeName := os.Getenv("NODE_NAME")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
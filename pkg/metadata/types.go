@@ -1,5 +1,8 @@
 package metadata
 
+import "time"
+
+// ContainerInfo 描述一个 ProjectID 的归属，Pod 级共享限额时 ContainerName 为空、VolumeName 为 "pod"
 type ContainerInfo struct {
 	ProjectID     uint32       `json:"project_id"`
 	Namespace     string       `json:"namespace"`
@@ -7,6 +10,8 @@ type ContainerInfo struct {
 	ContainerName string       `json:"container"`
 	VolumeName    string       `json:"volume_name"`
 	StorageType   STORAGE_TYPE `json:"storage_type"`
+	// GracePeriod 超过软限制后允许持续的时间，到期时记录 Event，0 表示不设宽限期
+	GracePeriod time.Duration `json:"grace_period"`
 }
 
 type STORAGE_TYPE string
@@ -14,4 +19,6 @@ type STORAGE_TYPE string
 const (
 	ROOTFS_TYPE   STORAGE_TYPE = "rootfs"
 	EMPTYDIR_TYPE STORAGE_TYPE = "emptyDir"
+	// POD_TYPE 是 Pod 内所有容器可写层与 emptyDir 共享的 ProjectID
+	POD_TYPE STORAGE_TYPE = "pod"
 )
@@ -12,4 +12,47 @@ type Hook interface {
 	Process(ctx context.Context, pod *api.PodSandbox, container *api.Container) error
 	Start(ctx context.Context, pod *api.PodSandbox, container *api.Container) error
 	Stop(ctx context.Context, pod *api.PodSandbox, container *api.Container) error
+	// Synchronize 在插件连接（或重连）到 NRI 时调用，用于校验并补齐节点上已有容器的限额
+	Synchronize(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container) error
+	// UpdateContainer 在容器资源更新时调用
+	UpdateContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container, resources *api.LinuxResources) error
+	// RemoveContainer 在容器被删除时调用，此后可写层不再保留
+	RemoveContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container) error
+	// RunPodSandbox 在 Pod sandbox 创建时调用，此时 kubelet 已完成卷的挂载
+	RunPodSandbox(ctx context.Context, pod *api.PodSandbox) error
+	StopPodSandbox(ctx context.Context, pod *api.PodSandbox) error
+	RemovePodSandbox(ctx context.Context, pod *api.PodSandbox) error
 }
+
+// BaseHook 为 Hook 的所有事件提供空实现，Hook 只需嵌入它并覆盖关心的事件
+type BaseHook struct{}
+
+func (BaseHook) Process(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
+	return nil
+}
+
+func (BaseHook) Start(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
+	return nil
+}
+
+func (BaseHook) Stop(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
+	return nil
+}
+
+func (BaseHook) Synchronize(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container) error {
+	return nil
+}
+
+func (BaseHook) UpdateContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container, resources *api.LinuxResources) error {
+	return nil
+}
+
+func (BaseHook) RemoveContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
+	return nil
+}
+
+func (BaseHook) RunPodSandbox(ctx context.Context, pod *api.PodSandbox) error { return nil }
+
+func (BaseHook) StopPodSandbox(ctx context.Context, pod *api.PodSandbox) error { return nil }
+
+func (BaseHook) RemovePodSandbox(ctx context.Context, pod *api.PodSandbox) error { return nil }
@@ -2,11 +2,25 @@ package nri
 
 import (
 	"context"
+	"errors"
 
 	"github.com/containerd/nri/pkg/api"
 	"k8s.io/klog/v2"
 )
 
+func (e *Enforcer) Synchronize(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container) ([]*api.ContainerUpdate, error) {
+	klog.InfoS("Event: Synchronize", "pods", len(pods), "containers", len(containers))
+
+	// --- 循环执行所有 Hook，单个 Hook 失败不影响其他 Hook 恢复状态 ---
+	for _, hook := range e.Hooks {
+		if err := hook.Synchronize(ctx, pods, containers); err != nil {
+			klog.ErrorS(err, "Hook synchronize failed", "hook", hook.Name())
+		}
+	}
+
+	return nil, nil
+}
+
 func (e *Enforcer) CreateContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
 	klog.V(2).InfoS("Event: CreateContainer", "container", container.Name)
 
@@ -37,12 +51,81 @@ func (e *Enforcer) StartContainer(ctx context.Context, pod *api.PodSandbox, cont
 func (e *Enforcer) StopContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container) ([]*api.ContainerUpdate, error) {
 	klog.V(2).InfoS("Event: StopContainer", "container", container.Name)
 
-	// --- 循环执行所有 Hook ---
+	// --- 清理类事件执行所有 Hook，单个 Hook 失败不影响其他 Hook 释放资源 ---
+	var errs []error
 	for _, hook := range e.Hooks {
 		if err := hook.Stop(ctx, pod, container); err != nil {
+			klog.ErrorS(err, "Hook failed", "hook", hook.Name())
+			errs = append(errs, err)
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (e *Enforcer) UpdateContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container, resources *api.LinuxResources) ([]*api.ContainerUpdate, error) {
+	klog.V(2).InfoS("Event: UpdateContainer", "container", container.Name)
+
+	// --- 循环执行所有 Hook ---
+	for _, hook := range e.Hooks {
+		if err := hook.UpdateContainer(ctx, pod, container, resources); err != nil {
 			klog.ErrorS(err, "Hook failed", "hook", hook.Name())
 			return nil, err
 		}
 	}
 	return nil, nil
 }
+
+func (e *Enforcer) RemoveContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
+	klog.V(2).InfoS("Event: RemoveContainer", "container", container.Name)
+
+	// --- 清理类事件执行所有 Hook，单个 Hook 失败不影响其他 Hook 释放资源 ---
+	var errs []error
+	for _, hook := range e.Hooks {
+		if err := hook.RemoveContainer(ctx, pod, container); err != nil {
+			klog.ErrorS(err, "Hook failed", "hook", hook.Name())
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *Enforcer) RunPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
+	klog.V(2).InfoS("Event: RunPodSandbox", "pod", pod.Name, "namespace", pod.Namespace)
+
+	// --- 循环执行所有 Hook ---
+	for _, hook := range e.Hooks {
+		if err := hook.RunPodSandbox(ctx, pod); err != nil {
+			klog.ErrorS(err, "Hook failed", "hook", hook.Name())
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Enforcer) StopPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
+	klog.V(2).InfoS("Event: StopPodSandbox", "pod", pod.Name, "namespace", pod.Namespace)
+
+	// --- 清理类事件执行所有 Hook，单个 Hook 失败不影响其他 Hook 释放资源 ---
+	var errs []error
+	for _, hook := range e.Hooks {
+		if err := hook.StopPodSandbox(ctx, pod); err != nil {
+			klog.ErrorS(err, "Hook failed", "hook", hook.Name())
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *Enforcer) RemovePodSandbox(ctx context.Context, pod *api.PodSandbox) error {
+	klog.V(2).InfoS("Event: RemovePodSandbox", "pod", pod.Name, "namespace", pod.Namespace)
+
+	// --- 清理类事件执行所有 Hook，单个 Hook 失败不影响其他 Hook 释放资源 ---
+	var errs []error
+	for _, hook := range e.Hooks {
+		if err := hook.RemovePodSandbox(ctx, pod); err != nil {
+			klog.ErrorS(err, "Hook failed", "hook", hook.Name())
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
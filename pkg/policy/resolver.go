@@ -0,0 +1,164 @@
+package policy
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// Resolver 通过 informer 缓存 TerminusQuotaPolicy 与 ClusterTerminusQuotaPolicy，
+// 计算 Pod 生效的策略。CRD 未安装或缓存未同步时，Resolve 返回空策略
+type Resolver struct {
+	kClient   kubernetes.Interface
+	dynClient dynamic.Interface
+
+	policyLister        cache.GenericLister
+	clusterPolicyLister cache.GenericLister
+	namespaceLister     corelisters.NamespaceLister
+
+	synced atomic.Bool
+}
+
+func NewResolver(kClient kubernetes.Interface, dynClient dynamic.Interface) *Resolver {
+	return &Resolver{
+		kClient:   kClient,
+		dynClient: dynClient,
+	}
+}
+
+// Run 启动 informer，直到 ctx 结束
+func (r *Resolver) Run(ctx context.Context) {
+	if _, err := r.kClient.Discovery().ServerResourcesForGroupVersion(GroupName + "/" + Version); err != nil {
+		klog.InfoS("Quota policy CRDs not installed, policies disabled", "groupVersion", GroupName+"/"+Version, "err", err)
+		return
+	}
+
+	dynFactory := dynamicinformer.NewDynamicSharedInformerFactory(r.dynClient, 0)
+	policyInformer := dynFactory.ForResource(TerminusQuotaPolicyResource)
+	clusterPolicyInformer := dynFactory.ForResource(ClusterTerminusQuotaPolicyResource)
+
+	factory := informers.NewSharedInformerFactory(r.kClient, 0)
+	namespaceInformer := factory.Core().V1().Namespaces()
+
+	r.policyLister = policyInformer.Lister()
+	r.clusterPolicyLister = clusterPolicyInformer.Lister()
+	r.namespaceLister = namespaceInformer.Lister()
+	policyInformer.Informer()
+	clusterPolicyInformer.Informer()
+	namespaceInformer.Informer()
+
+	dynFactory.Start(ctx.Done())
+	factory.Start(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(),
+		policyInformer.Informer().HasSynced,
+		clusterPolicyInformer.Informer().HasSynced,
+		namespaceInformer.Informer().HasSynced) {
+		return
+	}
+	r.synced.Store(true)
+	klog.Info("Quota policy cache synced")
+
+	<-ctx.Done()
+	dynFactory.Shutdown()
+	factory.Shutdown()
+}
+
+// Resolve 返回命名空间内带有 podLabels 的 Pod 生效的策略。
+// 命名空间级策略优先于集群级策略；同级多个策略匹配时按名称排序，靠前的优先，按字段合并
+func (r *Resolver) Resolve(namespace string, podLabels map[string]string) Limits {
+	limits := Limits{}
+	if r == nil || !r.synced.Load() {
+		return limits
+	}
+
+	objs, err := r.policyLister.ByNamespace(namespace).List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "Failed to list quota policies", "namespace", namespace)
+	}
+	for _, spec := range matchingSpecs(objs, podLabels, nil, false) {
+		limits.Rootfs.merge(spec.Rootfs)
+		limits.EmptyDir.merge(spec.EmptyDir)
+	}
+
+	var nsLabels map[string]string
+	if ns, err := r.namespaceLister.Get(namespace); err == nil {
+		nsLabels = ns.Labels
+	} else {
+		klog.V(4).InfoS("Failed to get namespace, matching cluster policies against no labels", "namespace", namespace, "err", err)
+	}
+
+	objs, err = r.clusterPolicyLister.List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "Failed to list cluster quota policies")
+	}
+	for _, spec := range matchingSpecs(objs, podLabels, nsLabels, true) {
+		limits.Rootfs.merge(spec.Rootfs)
+		limits.EmptyDir.merge(spec.EmptyDir)
+	}
+
+	return limits
+}
+
+// matchingSpecs 按名称排序返回匹配的策略，checkNamespace 为 false 时不检查 namespaceSelector
+func matchingSpecs(objs []runtime.Object, podLabels, nsLabels map[string]string, checkNamespace bool) []QuotaPolicySpec {
+	type named struct {
+		name string
+		spec QuotaPolicySpec
+	}
+
+	var matched []named
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+
+		var p TerminusQuotaPolicy
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &p); err != nil {
+			klog.ErrorS(err, "Invalid quota policy, ignoring", "kind", u.GetKind(), "namespace", u.GetNamespace(), "name", u.GetName())
+			continue
+		}
+
+		if !selects(p.Spec.PodSelector, podLabels) {
+			continue
+		}
+		if checkNamespace && !selects(p.Spec.NamespaceSelector, nsLabels) {
+			continue
+		}
+		matched = append(matched, named{name: p.Name, spec: p.Spec})
+	}
+
+	sort.Slice(matched, func(i, j int) bool { return matched[i].name < matched[j].name })
+
+	specs := make([]QuotaPolicySpec, 0, len(matched))
+	for _, m := range matched {
+		specs = append(specs, m.spec)
+	}
+	return specs
+}
+
+// selects 判断 selector 是否选中 labels，nil selector 选中所有对象
+func selects(selector *metav1.LabelSelector, set map[string]string) bool {
+	if selector == nil {
+		return true
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		klog.ErrorS(err, "Invalid label selector in quota policy, ignoring policy")
+		return false
+	}
+	return s.Matches(labels.Set(set))
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	GroupName = "storage.terminus.io"
+	Version   = "v1alpha1"
+)
+
+var (
+	// TerminusQuotaPolicyResource 是命名空间级策略
+	TerminusQuotaPolicyResource = schema.GroupVersionResource{Group: GroupName, Version: Version, Resource: "terminusquotapolicies"}
+	// ClusterTerminusQuotaPolicyResource 是集群级策略
+	ClusterTerminusQuotaPolicyResource = schema.GroupVersionResource{Group: GroupName, Version: Version, Resource: "clusterterminusquotapolicies"}
+)
+
+// TerminusQuotaPolicy 为所在命名空间中被选中的 Pod 提供默认限额与上限
+type TerminusQuotaPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec QuotaPolicySpec `json:"spec"`
+}
+
+// ClusterTerminusQuotaPolicy 与 TerminusQuotaPolicy 相同，额外通过 namespaceSelector 选择命名空间
+type ClusterTerminusQuotaPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec QuotaPolicySpec `json:"spec"`
+}
+
+type QuotaPolicySpec struct {
+	// NamespaceSelector 只对 ClusterTerminusQuotaPolicy 生效，为空时选择所有命名空间
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// PodSelector 为空时选择所有 Pod
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+
+	Rootfs   StorageLimits `json:"rootfs,omitempty"`
+	EmptyDir StorageLimits `json:"emptyDir,omitempty"`
+}
+
+// StorageLimits 中未设置的字段不生效
+type StorageLimits struct {
+	// DefaultSize 在 Pod 未声明限额时使用
+	DefaultSize *resource.Quantity `json:"defaultSize,omitempty"`
+	// MaxSize 是允许声明的最大限额，超过时 webhook 拒绝 Pod
+	MaxSize       *resource.Quantity `json:"maxSize,omitempty"`
+	DefaultInodes *resource.Quantity `json:"defaultInodes,omitempty"`
+	MaxInodes     *resource.Quantity `json:"maxInodes,omitempty"`
+}
+
+// Limits 是 Pod 最终生效的策略，按字段合并自所有匹配的策略
+type Limits struct {
+	Rootfs   StorageLimits
+	EmptyDir StorageLimits
+}
+
+// merge 只填充 l 中尚未设置的字段
+func (l *StorageLimits) merge(o StorageLimits) {
+	if l.DefaultSize == nil {
+		l.DefaultSize = o.DefaultSize
+	}
+	if l.MaxSize == nil {
+		l.MaxSize = o.MaxSize
+	}
+	if l.DefaultInodes == nil {
+		l.DefaultInodes = o.DefaultInodes
+	}
+	if l.MaxInodes == nil {
+		l.MaxInodes = o.MaxInodes
+	}
+}
@@ -19,10 +19,12 @@ type NodeStorageStats struct {
 const (
 	nodeStoragePhyTotal = "storage.terminus.io/physical-total"
 	nodeStoragePhyUsed  = "storage.terminus.io/physical-used"
+	nodeInodesPhyTotal  = "storage.terminus.io/physical-inodes-total"
+	nodeInodesPhyUsed   = "storage.terminus.io/physical-inodes-used"
 	GiB                 = 1024 * 1024 * 1024
 )
 
-func (r *reporter) ReportToAnnotation(ctx context.Context, diskUsage, diskTotal uint64) error {
+func (r *reporter) ReportToAnnotation(ctx context.Context, diskUsage, diskTotal, inodesUsed, inodesTotal uint64) error {
 
 	usage := fmt.Sprintf("%vGi", diskUsage/1024/1024/1024)
 	total := fmt.Sprintf("%vGi", diskTotal/1024/1024/1024)
@@ -31,6 +33,8 @@ func (r *reporter) ReportToAnnotation(ctx context.Context, diskUsage, diskTotal
 			"annotations": map[string]string{
 				nodeStoragePhyTotal: total,
 				nodeStoragePhyUsed:  usage,
+				nodeInodesPhyTotal:  fmt.Sprintf("%d", inodesTotal),
+				nodeInodesPhyUsed:   fmt.Sprintf("%d", inodesUsed),
 			},
 		},
 	}
@@ -91,6 +95,8 @@ func (r *reporter) ResetReportAnnotation() error {
 			"annotations": map[string]interface{}{
 				nodeStoragePhyTotal: nil,
 				nodeStoragePhyUsed:  nil,
+				nodeInodesPhyTotal:  nil,
+				nodeInodesPhyUsed:   nil,
 			},
 		},
 	}
@@ -0,0 +1,117 @@
+package reporter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/terminus-io/Terminus/pkg/k8s"
+	"github.com/terminus-io/Terminus/pkg/metadata"
+	terminus_quota "github.com/terminus-io/quota"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+const (
+	maxProjectID = uint32(999999999)
+
+	ReasonSoftLimitExceeded     = "SoftLimitExceeded"
+	ReasonSoftLimitGraceExpired = "SoftLimitGraceExpired"
+	ReasonSoftLimitRecovered    = "SoftLimitRecovered"
+)
+
+// SoftLimitWatcher 周期性检查软限制，超过时与宽限期结束时在 Pod 上记录 Event。
+// 宽限期仅用于提示：quota 库没有设置 grace timer 的接口，宽限期结束后只记录 Event，写入仍只受硬限制拦截
+type SoftLimitWatcher struct {
+	store          *metadata.AsyncStore
+	recorder       record.EventRecorder
+	containerdPath string
+	kubeletPath    string
+	Interval       time.Duration
+}
+
+func NewSoftLimitWatcher(store *metadata.AsyncStore, recorder record.EventRecorder, containerdPath, kubeletPath string, interval time.Duration) *SoftLimitWatcher {
+	return &SoftLimitWatcher{
+		store:          store,
+		recorder:       recorder,
+		containerdPath: containerdPath,
+		kubeletPath:    kubeletPath,
+		Interval:       interval,
+	}
+}
+
+func (w *SoftLimitWatcher) Run(ctx context.Context) {
+	klog.InfoS("Starting soft limit watcher", "interval", w.Interval)
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			klog.Info("Soft limit watcher stopped")
+			return
+		case <-ticker.C:
+			w.check(w.containerdPath, metadata.ROOTFS_TYPE)
+			w.check(w.kubeletPath, metadata.EMPTYDIR_TYPE)
+		}
+	}
+}
+
+func (w *SoftLimitWatcher) check(mountPoint string, storageType metadata.STORAGE_TYPE) {
+	quotaInfos, err := terminus_quota.ListQuotas(mountPoint, terminus_quota.ProjQuota, maxProjectID)
+	if err != nil {
+		klog.ErrorS(err, "Failed to list project quotas", "mountPoint", mountPoint)
+		return
+	}
+
+	now := time.Now()
+	for _, r := range quotaInfos {
+		info, ok := w.store.Get(r.ID)
+		if !ok || info.StorageType != storageType || r.BlockSoftLimit == 0 {
+			continue
+		}
+
+		ref := k8s.PodReference(info.Namespace, info.PodName, "")
+		target := describeTarget(info)
+
+		if r.CurrentBlocks <= r.BlockSoftLimit {
+			if w.store.ClearSoftLimitExceeded(r.ID) {
+				w.recorder.Eventf(ref, v1.EventTypeNormal, ReasonSoftLimitRecovered,
+					"%s usage %dKi is back below soft limit %dKi", target, r.CurrentBlocks, r.BlockSoftLimit)
+			}
+			continue
+		}
+
+		since, first := w.store.MarkSoftLimitExceeded(r.ID, now)
+		if first {
+			msg := fmt.Sprintf("%s usage %dKi exceeds soft limit %dKi (hard limit %dKi)",
+				target, r.CurrentBlocks, r.BlockSoftLimit, r.BlockHardLimit)
+			if info.GracePeriod > 0 {
+				msg += fmt.Sprintf(", grace period %s", info.GracePeriod)
+			}
+			klog.InfoS("Soft limit exceeded", "projectID", r.ID, "pod", info.PodName, "namespace", info.Namespace)
+			w.recorder.Event(ref, v1.EventTypeWarning, ReasonSoftLimitExceeded, msg)
+		}
+
+		if info.GracePeriod == 0 || now.Sub(since) < info.GracePeriod {
+			continue
+		}
+
+		if !w.store.MarkGraceExpired(r.ID) {
+			continue
+		}
+
+		klog.InfoS("Soft limit grace period expired", "projectID", r.ID, "pod", info.PodName, "namespace", info.Namespace)
+		w.recorder.Eventf(ref, v1.EventTypeWarning, ReasonSoftLimitGraceExpired,
+			"%s grace period %s expired, usage %dKi still exceeds soft limit %dKi (hard limit %dKi)",
+			target, info.GracePeriod, r.CurrentBlocks, r.BlockSoftLimit, r.BlockHardLimit)
+	}
+}
+
+func describeTarget(info metadata.ContainerInfo) string {
+	if info.StorageType == metadata.EMPTYDIR_TYPE {
+		return fmt.Sprintf("emptyDir %s", info.VolumeName)
+	}
+	return fmt.Sprintf("container %s rootfs", info.ContainerName)
+}
@@ -0,0 +1,148 @@
+package scheduler
+
+import (
+	"sync"
+
+	"github.com/terminus-io/Terminus/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// podUsage 为 Pod 或节点上声明的磁盘与 inode 限额
+type podUsage struct {
+	bytes  int64
+	inodes int64
+}
+
+func (u *podUsage) add(o podUsage) {
+	u.bytes += o.bytes
+	u.inodes += o.inodes
+}
+
+func (u *podUsage) sub(o podUsage) {
+	u.bytes -= o.bytes
+	u.inodes -= o.inodes
+}
+
+func podDemand(pod *v1.Pod) podUsage {
+	return podUsage{
+		bytes:  utils.GetPodStorageDemand(pod),
+		inodes: utils.GetPodTotalInodes(pod),
+	}
+}
+
+type committedPod struct {
+	nodeName string
+	usage    podUsage
+	// reserved 为 true 表示 Pod 由 Reserve 加入，informer 尚未看到绑定结果
+	reserved bool
+}
+
+// committedIndex 按节点汇总已分配 Pod 的限额，由 Pod informer 事件维护，
+// Filter 与 Score 不再需要遍历节点上的所有 Pod
+type committedIndex struct {
+	mu    sync.RWMutex
+	pods  map[types.UID]committedPod
+	nodes map[string]podUsage
+}
+
+func newCommittedIndex() *committedIndex {
+	return &committedIndex{
+		pods:  make(map[types.UID]committedPod),
+		nodes: make(map[string]podUsage),
+	}
+}
+
+// eventHandler 返回 Pod informer 的事件处理函数
+func (c *committedIndex) eventHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.onPodUpdate,
+		UpdateFunc: func(oldObj, newObj interface{}) { c.onPodUpdate(newObj) },
+		DeleteFunc: c.onPodDelete,
+	}
+}
+
+func (c *committedIndex) onPodUpdate(obj interface{}) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return
+	}
+
+	// 已结束的 Pod 不再占用磁盘，与调度器缓存保持一致
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		c.remove(pod.UID)
+		return
+	}
+	if pod.Spec.NodeName == "" {
+		return
+	}
+
+	c.set(pod.UID, committedPod{nodeName: pod.Spec.NodeName, usage: podDemand(pod)})
+}
+
+func (c *committedIndex) onPodDelete(obj interface{}) {
+	switch t := obj.(type) {
+	case *v1.Pod:
+		c.remove(t.UID)
+	case cache.DeletedFinalStateUnknown:
+		if pod, ok := t.Obj.(*v1.Pod); ok {
+			c.remove(pod.UID)
+		}
+	}
+}
+
+// reserve 在 Pod 绑定前将其计入节点，informer 看到绑定后由 onPodUpdate 覆盖
+func (c *committedIndex) reserve(nodeName string, pod *v1.Pod, usage podUsage) {
+	c.set(pod.UID, committedPod{nodeName: nodeName, usage: usage, reserved: true})
+}
+
+// unreserve 撤销 reserve，informer 已确认绑定的 Pod 不受影响
+func (c *committedIndex) unreserve(uid types.UID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if old, ok := c.pods[uid]; ok && old.reserved {
+		c.deleteLocked(uid, old)
+	}
+}
+
+func (c *committedIndex) set(uid types.UID, pod committedPod) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if old, ok := c.pods[uid]; ok {
+		c.deleteLocked(uid, old)
+	}
+	c.pods[uid] = pod
+	usage := c.nodes[pod.nodeName]
+	usage.add(pod.usage)
+	c.nodes[pod.nodeName] = usage
+}
+
+func (c *committedIndex) remove(uid types.UID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if old, ok := c.pods[uid]; ok {
+		c.deleteLocked(uid, old)
+	}
+}
+
+func (c *committedIndex) deleteLocked(uid types.UID, old committedPod) {
+	delete(c.pods, uid)
+	usage := c.nodes[old.nodeName]
+	usage.sub(old.usage)
+	if usage == (podUsage{}) {
+		delete(c.nodes, old.nodeName)
+		return
+	}
+	c.nodes[old.nodeName] = usage
+}
+
+// get 返回节点上已分配的限额
+func (c *committedIndex) get(nodeName string) podUsage {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.nodes[nodeName]
+}
@@ -1,8 +1,21 @@
 package scheduler
 
 import (
+	"fmt"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/klog/v2"
+	"k8s.io/apimachinery/pkg/runtime"
+	frameworkruntime "k8s.io/kubernetes/pkg/scheduler/framework/runtime"
+)
+
+// 节点没有 Terminus 存储 annotation（未运行 enforcer）时 Filter 的处理方式
+const (
+	// UnannotatedNodeReject 拒绝所有 Pod
+	UnannotatedNodeReject = "reject"
+	// UnannotatedNodeAllowIfNoDemand 只允许不申请磁盘与 inode 的 Pod
+	UnannotatedNodeAllowIfNoDemand = "allowIfNoDemand"
+	// UnannotatedNodeAllow 允许所有 Pod
+	UnannotatedNodeAllow = "allow"
 )
 
 type TerminusArgs struct {
@@ -15,6 +28,10 @@ type TerminusArgs struct {
 	ModelName             string  `json:"modelName"`
 	OpenAIAPIKey          string  `json:"openAIAPIKey"`
 	OpenAIAPIURL          string  `json:"openAIAPIURL"`
+	// AssumeTimeoutSeconds 为 Reserve 后计入节点用量的最长时间，Pod 运行后节点再次上报 physical-used 时提前清除
+	AssumeTimeoutSeconds int `json:"assumeTimeoutSeconds"`
+	// UnannotatedNodePolicy 为 reject、allowIfNoDemand 或 allow，默认 reject
+	UnannotatedNodePolicy string `json:"unannotatedNodePolicy"`
 }
 
 // 默认配置
@@ -27,12 +44,53 @@ func (args *TerminusArgs) SetDefaults() {
 		args.AiWeightRatio = 30
 	}
 
-	if args.AiWeightRatio > 100 || args.AiWeightRatio < 0 {
-		klog.Warningf("Invalid AiWeightRatio: %d. Must be between 0 and 100. Reverting to default (40).", args.AiWeightRatio)
-		args.AiWeightRatio = 30
+	if args.AssumeTimeoutSeconds == 0 {
+		args.AssumeTimeoutSeconds = 90
+	}
+
+	if args.UnannotatedNodePolicy == "" {
+		args.UnannotatedNodePolicy = UnannotatedNodeReject
 	}
 
 	if args.Namespace == "" {
 		args.Namespace = "kube-system"
 	}
 }
+
+// decodeArgs 解码插件参数。SetDefaults 在解码前执行，只为未配置的字段提供默认值，
+// 显式配置的值不会被覆盖，由 Validate 校验
+func decodeArgs(obj runtime.Object) (*TerminusArgs, error) {
+	args := &TerminusArgs{}
+	args.SetDefaults()
+	if err := frameworkruntime.DecodeInto(obj, args); err != nil {
+		return nil, fmt.Errorf("failed to decode TerminusArgs: %v", err)
+	}
+	if err := args.Validate(); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// Validate 校验解码后的参数
+func (args *TerminusArgs) Validate() error {
+	if args.OversubscriptionRatio < 1.0 {
+		return fmt.Errorf("oversubscriptionRatio must be >= 1.0, got %f", args.OversubscriptionRatio)
+	}
+
+	if args.AiWeightRatio < 0 || args.AiWeightRatio > 100 {
+		return fmt.Errorf("aiWeightRatio must be between 0 and 100, got %d", args.AiWeightRatio)
+	}
+
+	// ttl 不为正时 Reserve 记录立即过期，assumed 用量不再生效
+	if args.AssumeTimeoutSeconds <= 0 {
+		return fmt.Errorf("assumeTimeoutSeconds must be > 0, got %d", args.AssumeTimeoutSeconds)
+	}
+
+	switch args.UnannotatedNodePolicy {
+	case UnannotatedNodeReject, UnannotatedNodeAllowIfNoDemand, UnannotatedNodeAllow:
+	default:
+		return fmt.Errorf("unannotatedNodePolicy must be one of %s, %s, %s, got %q",
+			UnannotatedNodeReject, UnannotatedNodeAllowIfNoDemand, UnannotatedNodeAllow, args.UnannotatedNodePolicy)
+	}
+	return nil
+}
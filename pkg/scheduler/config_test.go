@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestDecodeArgs(t *testing.T) {
+	defaults := TerminusArgs{
+		Namespace:             "kube-system",
+		OversubscriptionRatio: 1.0,
+		AiWeightRatio:         30,
+		AssumeTimeoutSeconds:  90,
+		UnannotatedNodePolicy: UnannotatedNodeReject,
+	}
+
+	tests := []struct {
+		name    string
+		obj     runtime.Object
+		want    TerminusArgs
+		wantErr bool
+	}{
+		{
+			name: "nil args",
+			want: defaults,
+		},
+		{
+			name: "empty args",
+			obj:  &runtime.Unknown{Raw: []byte(`{}`)},
+			want: defaults,
+		},
+		{
+			name: "explicit values are kept",
+			obj: &runtime.Unknown{Raw: []byte(`{"namespace":"terminus","oversubscriptionRatio":1.5,` +
+				`"aiWeightRatio":50,"assumeTimeoutSeconds":30,"unannotatedNodePolicy":"allowIfNoDemand"}`)},
+			want: TerminusArgs{
+				Namespace:             "terminus",
+				OversubscriptionRatio: 1.5,
+				AiWeightRatio:         50,
+				AssumeTimeoutSeconds:  30,
+				UnannotatedNodePolicy: UnannotatedNodeAllowIfNoDemand,
+			},
+		},
+		{
+			name:    "zero assumeTimeoutSeconds is rejected",
+			obj:     &runtime.Unknown{Raw: []byte(`{"assumeTimeoutSeconds":0}`)},
+			wantErr: true,
+		},
+		{
+			name:    "negative assumeTimeoutSeconds is rejected",
+			obj:     &runtime.Unknown{Raw: []byte(`{"assumeTimeoutSeconds":-1}`)},
+			wantErr: true,
+		},
+		{
+			name:    "aiWeightRatio out of range is rejected",
+			obj:     &runtime.Unknown{Raw: []byte(`{"aiWeightRatio":150}`)},
+			wantErr: true,
+		},
+		{
+			name:    "oversubscriptionRatio below 1 is rejected",
+			obj:     &runtime.Unknown{Raw: []byte(`{"oversubscriptionRatio":0.5}`)},
+			wantErr: true,
+		},
+		{
+			name:    "unknown unannotatedNodePolicy is rejected",
+			obj:     &runtime.Unknown{Raw: []byte(`{"unannotatedNodePolicy":"ignore"}`)},
+			wantErr: true,
+		},
+		{
+			name:    "malformed args",
+			obj:     &runtime.Unknown{Raw: []byte(`{"assumeTimeoutSeconds":"90"}`)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeArgs(tt.obj)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodeArgs() = %+v, want error", *got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeArgs() error = %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("decodeArgs() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
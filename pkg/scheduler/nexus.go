@@ -95,7 +95,7 @@ func (p *TerminusSchedulerPlugin) runNexusAnalyzer(ctx context.Context, agent bl
 		nodePodUsage := make(map[string]int64)
 		for _, pod := range pods {
 			if pod.Spec.NodeName != "" && pod.Status.Phase != "Succeeded" && pod.Status.Phase != "Failed" {
-				nodePodUsage[pod.Spec.NodeName] += utils.GetPodTotalStorage(pod)
+				nodePodUsage[pod.Spec.NodeName] += utils.GetPodStorageDemand(pod)
 			}
 		}
 
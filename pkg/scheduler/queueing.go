@@ -0,0 +1,75 @@
+package scheduler
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	schdulerFramework "k8s.io/kubernetes/pkg/scheduler/framework"
+	schedutil "k8s.io/kubernetes/pkg/scheduler/util"
+)
+
+var _ schdulerFramework.EnqueueExtensions = &TerminusSchedulerPlugin{}
+
+// nodeStatsAnnotations 为 enforcer 上报的节点存储统计，变化时 Filter 的结果可能改变
+var nodeStatsAnnotations = []string{nodeAnnotationTotal, nodeAnnotationUsed, nodeInodesTotal, nodeInodesUsed}
+
+// EventsToRegister 返回可能让被本插件拒绝的 Pod 变为可调度的事件：
+// 节点上报新的存储统计，以及已分配磁盘限额的 Pod 被删除
+func (p *TerminusSchedulerPlugin) EventsToRegister(_ context.Context) ([]schdulerFramework.ClusterEventWithHint, error) {
+	return []schdulerFramework.ClusterEventWithHint{
+		{Event: schdulerFramework.ClusterEvent{Resource: schdulerFramework.Node, ActionType: schdulerFramework.Add | schdulerFramework.UpdateNodeAnnotation}, QueueingHintFn: p.isSchedulableAfterNodeChange},
+		{Event: schdulerFramework.ClusterEvent{Resource: schdulerFramework.Pod, ActionType: schdulerFramework.Delete}, QueueingHintFn: p.isSchedulableAfterPodDeleted},
+	}, nil
+}
+
+// isSchedulableAfterNodeChange 只在节点存储统计变化时重新入队，心跳等无关的 annotation 更新跳过
+func (p *TerminusSchedulerPlugin) isSchedulableAfterNodeChange(logger klog.Logger, pod *v1.Pod, oldObj, newObj interface{}) (schdulerFramework.QueueingHint, error) {
+	oldNode, newNode, err := schedutil.As[*v1.Node](oldObj, newObj)
+	if err != nil {
+		return schdulerFramework.Queue, err
+	}
+
+	if oldNode == nil {
+		// 未上报统计的新节点只有在 UnannotatedNodePolicy 允许时才可能调度
+		if hasNodeStats(newNode) || p.args.UnannotatedNodePolicy != UnannotatedNodeReject {
+			logger.V(5).Info("node with Terminus storage stats added", "pod", klog.KObj(pod), "node", klog.KObj(newNode))
+			return schdulerFramework.Queue, nil
+		}
+		return schdulerFramework.QueueSkip, nil
+	}
+
+	for _, key := range nodeStatsAnnotations {
+		if oldNode.Annotations[key] != newNode.Annotations[key] {
+			logger.V(5).Info("node storage stats changed", "pod", klog.KObj(pod), "node", klog.KObj(newNode), "annotation", key)
+			return schdulerFramework.Queue, nil
+		}
+	}
+
+	return schdulerFramework.QueueSkip, nil
+}
+
+// isSchedulableAfterPodDeleted 在已绑定且声明了磁盘或 inode 限额的 Pod 删除后重新入队。
+// 不申请存储的 Pod 只会因节点物理用量或缺少统计被拒绝，Pod 删除不会改变结果
+func (p *TerminusSchedulerPlugin) isSchedulableAfterPodDeleted(logger klog.Logger, pod *v1.Pod, oldObj, newObj interface{}) (schdulerFramework.QueueingHint, error) {
+	deletedPod, _, err := schedutil.As[*v1.Pod](oldObj, newObj)
+	if err != nil {
+		return schdulerFramework.Queue, err
+	}
+
+	if deletedPod == nil || deletedPod.Spec.NodeName == "" {
+		return schdulerFramework.QueueSkip, nil
+	}
+	if podDemand(deletedPod) == (podUsage{}) || podDemand(pod) == (podUsage{}) {
+		return schdulerFramework.QueueSkip, nil
+	}
+
+	logger.V(5).Info("pod with Terminus storage quota deleted", "pod", klog.KObj(pod), "deletedPod", klog.KObj(deletedPod))
+	return schdulerFramework.Queue, nil
+}
+
+func hasNodeStats(node *v1.Node) bool {
+	_, total := node.Annotations[nodeAnnotationTotal]
+	_, used := node.Annotations[nodeAnnotationUsed]
+	return total && used
+}
@@ -0,0 +1,166 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	schdulerFramework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+var _ schdulerFramework.ReservePlugin = &TerminusSchedulerPlugin{}
+
+// assumedPod 为已 Reserve 但用量尚未出现在节点上报值中的 Pod。
+// running 为观察到 Pod 离开 Pending 的时间，零值表示尚未运行
+type assumedPod struct {
+	bytes    int64
+	deadline time.Time
+	running  time.Time
+}
+
+// assumedCache 记录每个节点上 assumed 的磁盘用量。
+// 节点 physical-used 由 enforcer 周期上报，Pod 在节点上运行前的用量不会出现在上报值中，
+// 两次上报之间调度的 Pod 需要计入，否则会通过同一个旧值的校验
+type assumedCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	nodes map[string]map[types.UID]assumedPod
+}
+
+func newAssumedCache(ttl time.Duration) *assumedCache {
+	return &assumedCache{
+		ttl:   ttl,
+		nodes: make(map[string]map[types.UID]assumedPod),
+	}
+}
+
+func (c *assumedCache) assume(nodeName string, uid types.UID, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pods, ok := c.nodes[nodeName]
+	if !ok {
+		pods = make(map[types.UID]assumedPod)
+		c.nodes[nodeName] = pods
+	}
+	pods[uid] = assumedPod{bytes: bytes, deadline: time.Now().Add(c.ttl)}
+}
+
+// markRunning 记录 Pod 开始运行的时间。此时节点上报值可能仍是运行前的旧值，
+// 需要等到之后的上报才能移除
+func (c *assumedCache) markRunning(nodeName string, uid types.UID, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pod, ok := c.nodes[nodeName][uid]
+	if !ok || !pod.running.IsZero() {
+		return
+	}
+	pod.running = now
+	c.nodes[nodeName][uid] = pod
+}
+
+// observe 在节点上报新的 physical-used 后调用，移除运行时间早于本次上报的 Pod，其用量已包含在上报值中
+func (c *assumedCache) observe(nodeName string, reportedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for uid, pod := range c.nodes[nodeName] {
+		if !pod.running.IsZero() && reportedAt.After(pod.running) {
+			delete(c.nodes[nodeName], uid)
+		}
+	}
+	if len(c.nodes[nodeName]) == 0 {
+		delete(c.nodes, nodeName)
+	}
+}
+
+func (c *assumedCache) forget(nodeName string, uid types.UID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.nodes[nodeName], uid)
+	if len(c.nodes[nodeName]) == 0 {
+		delete(c.nodes, nodeName)
+	}
+}
+
+// eventHandler 返回 Pod informer 的事件处理函数，记录 Pod 开始运行的时间，Pod 删除后不再计入 assumed 用量
+func (c *assumedCache) eventHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) { c.onPodUpdate(newObj) },
+		DeleteFunc: c.onPodDelete,
+	}
+}
+
+func (c *assumedCache) onPodUpdate(obj interface{}) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || pod.Spec.NodeName == "" {
+		return
+	}
+	if pod.Status.Phase != v1.PodPending {
+		c.markRunning(pod.Spec.NodeName, pod.UID, time.Now())
+	}
+}
+
+func (c *assumedCache) onPodDelete(obj interface{}) {
+	switch t := obj.(type) {
+	case *v1.Pod:
+		c.forget(t.Spec.NodeName, t.UID)
+	case cache.DeletedFinalStateUnknown:
+		if pod, ok := t.Obj.(*v1.Pod); ok {
+			c.forget(pod.Spec.NodeName, pod.UID)
+		}
+	}
+}
+
+func (c *assumedCache) removeNode(nodeName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.nodes, nodeName)
+}
+
+// bytes 返回节点上 assumed 的磁盘用量。超过 ttl 仍未运行的 Pod 不再计入，避免拉取镜像失败等情况长期占用节点
+func (c *assumedCache) bytes(nodeName string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var total int64 = 0
+	for uid, pod := range c.nodes[nodeName] {
+		if now.After(pod.deadline) {
+			delete(c.nodes[nodeName], uid)
+			continue
+		}
+		total += pod.bytes
+	}
+	if len(c.nodes[nodeName]) == 0 {
+		delete(c.nodes, nodeName)
+	}
+	return total
+}
+
+// Reserve 将 Pod 的限额计入节点的已分配限额，并将磁盘限额计入 assumed 用量，
+// 直到 Pod 运行后节点再次上报 physical-used 或超过 ttl
+func (p *TerminusSchedulerPlugin) Reserve(ctx context.Context, state *schdulerFramework.CycleState, pod *v1.Pod, nodeName string) *schdulerFramework.Status {
+	demand := p.preFilterState(state, pod).demand
+	p.committed.reserve(nodeName, pod, demand)
+
+	if demand.bytes == 0 {
+		return nil
+	}
+
+	p.assumed.assume(nodeName, pod.UID, demand.bytes)
+	klog.V(4).Infof("%s pod assumed %d bytes on node %s", pod.Name, demand.bytes, nodeName)
+	return nil
+}
+
+// Unreserve 在绑定失败时撤销 Reserve 计入的用量
+func (p *TerminusSchedulerPlugin) Unreserve(ctx context.Context, state *schdulerFramework.CycleState, pod *v1.Pod, nodeName string) {
+	p.committed.unreserve(pod.UID)
+	p.assumed.forget(nodeName, pod.UID)
+}
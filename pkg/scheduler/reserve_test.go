@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestAssumedCacheExpiry(t *testing.T) {
+	pod := func(node string, phase v1.PodPhase) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{UID: types.UID("a")},
+			Spec:       v1.PodSpec{NodeName: node},
+			Status:     v1.PodStatus{Phase: phase},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		event func(c *assumedCache)
+		want  int64
+	}{
+		{
+			name:  "pending pod stays assumed",
+			ttl:   time.Minute,
+			event: func(c *assumedCache) { c.onPodUpdate(pod("node-1", v1.PodPending)) },
+			want:  100,
+		},
+		{
+			name:  "running pod stays assumed until the node reports",
+			ttl:   time.Minute,
+			event: func(c *assumedCache) { c.onPodUpdate(pod("node-1", v1.PodRunning)) },
+			want:  100,
+		},
+		{
+			name: "report after running drops the pod",
+			ttl:  time.Minute,
+			event: func(c *assumedCache) {
+				c.onPodUpdate(pod("node-1", v1.PodRunning))
+				c.observe("node-1", time.Now().Add(time.Second))
+			},
+			want: 0,
+		},
+		{
+			name: "report before running keeps the pod",
+			ttl:  time.Minute,
+			event: func(c *assumedCache) {
+				c.observe("node-1", time.Now())
+				c.onPodUpdate(pod("node-1", v1.PodRunning))
+			},
+			want: 100,
+		},
+		{
+			name: "report while pending keeps the pod",
+			ttl:  time.Minute,
+			event: func(c *assumedCache) {
+				c.onPodUpdate(pod("node-1", v1.PodPending))
+				c.observe("node-1", time.Now().Add(time.Second))
+			},
+			want: 100,
+		},
+		{
+			name:  "pod running on another node does not match",
+			ttl:   time.Minute,
+			event: func(c *assumedCache) { c.onPodUpdate(pod("node-2", v1.PodRunning)) },
+			want:  100,
+		},
+		{
+			name: "failed pod is dropped by the next report",
+			ttl:  time.Minute,
+			event: func(c *assumedCache) {
+				c.onPodUpdate(pod("node-1", v1.PodFailed))
+				c.observe("node-1", time.Now().Add(time.Second))
+			},
+			want: 0,
+		},
+		{
+			name: "deleted pod is forgotten",
+			ttl:  time.Minute,
+			event: func(c *assumedCache) {
+				c.onPodDelete(cache.DeletedFinalStateUnknown{Obj: pod("node-1", v1.PodPending)})
+			},
+			want: 0,
+		},
+		{
+			name:  "expired entry is dropped",
+			ttl:   -time.Second,
+			event: func(c *assumedCache) {},
+			want:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newAssumedCache(tt.ttl)
+			c.assume("node-1", types.UID("a"), 100)
+			tt.event(c)
+			if got := c.bytes("node-1"); got != tt.want {
+				t.Errorf("bytes() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
-	"github.com/terminus-io/Terminus/pkg/utils"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -13,13 +13,15 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	schdulerFramework "k8s.io/kubernetes/pkg/scheduler/framework"
-	frameworkruntime "k8s.io/kubernetes/pkg/scheduler/framework/runtime"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/helper"
 )
 
 const (
 	SchedulerName       = "terminus-scheduler"
 	nodeAnnotationTotal = "storage.terminus.io/physical-total"
 	nodeAnnotationUsed  = "storage.terminus.io/physical-used"
+	nodeInodesTotal     = "storage.terminus.io/physical-inodes-total"
+	nodeInodesUsed      = "storage.terminus.io/physical-inodes-used"
 	threshold           = 0.95
 )
 
@@ -31,6 +33,8 @@ type TerminusSchedulerPlugin struct {
 	podLister      listersv1.PodLister
 	args           *TerminusArgs
 	nexusStartOnce sync.Once
+	assumed        *assumedCache
+	committed      *committedIndex
 }
 
 var _ schdulerFramework.FilterPlugin = &TerminusSchedulerPlugin{}
@@ -38,14 +42,9 @@ var _ schdulerFramework.ScorePlugin = &TerminusSchedulerPlugin{}
 
 func New(ctx context.Context, obj runtime.Object, h schdulerFramework.Handle) (schdulerFramework.Plugin, error) {
 
-	args := &TerminusArgs{}
-	args.SetDefaults()
-	if err := frameworkruntime.DecodeInto(obj, args); err != nil {
-		return nil, fmt.Errorf("failed to decode TerminusArgs: %v", err)
-	}
-
-	if args.OversubscriptionRatio < 1.0 {
-		return nil, fmt.Errorf("oversubscriptionRatio must be >= 1.0, got %f", args.OversubscriptionRatio)
+	args, err := decodeArgs(obj)
+	if err != nil {
+		return nil, err
 	}
 
 	klog.V(4).Infof("Terminus Scheduler loaded with Ratio: %.2f\n", args.OversubscriptionRatio)
@@ -56,6 +55,8 @@ func New(ctx context.Context, obj runtime.Object, h schdulerFramework.Handle) (s
 		podLister: podLister,
 		aiScores:  make(map[string]int64),
 		args:      args,
+		assumed:   newAssumedCache(time.Duration(args.AssumeTimeoutSeconds) * time.Second),
+		committed: newCommittedIndex(),
 	}
 
 	if args.UseAI {
@@ -74,6 +75,10 @@ func New(ctx context.Context, obj runtime.Object, h schdulerFramework.Handle) (s
 		DeleteFunc: plugin.handleNodeDelete,
 	})
 
+	podInformer := h.SharedInformerFactory().Core().V1().Pods().Informer()
+	podInformer.AddEventHandler(plugin.committed.eventHandler())
+	podInformer.AddEventHandler(plugin.assumed.eventHandler())
+
 	return plugin, nil
 }
 
@@ -85,14 +90,17 @@ func (p *TerminusSchedulerPlugin) handleNodeUpdate(obj interface{}) {
 		return
 	}
 
+	// annotation 被 enforcer 清除或无法解析时移除统计，节点按 UnannotatedNodePolicy 处理
 	totalAnno, err := resource.ParseQuantity(node.Annotations[nodeAnnotationTotal])
 	if err != nil {
+		p.statsCache.Delete(node.Name)
 		return
 	}
 
 	usedAnno, err := resource.ParseQuantity(node.Annotations[nodeAnnotationUsed])
 
 	if err != nil {
+		p.statsCache.Delete(node.Name)
 		return
 	}
 
@@ -101,13 +109,27 @@ func (p *TerminusSchedulerPlugin) handleNodeUpdate(obj interface{}) {
 		return
 	}
 
+	// physical-used 变化说明 enforcer 完成了一次新的上报，已运行 Pod 的用量包含在其中
+	if val, ok := p.statsCache.Load(node.Name); !ok || val.(map[string]int64)[nodeAnnotationUsed] != usedAnno.Value() {
+		p.assumed.observe(node.Name, time.Now())
+	}
+
 	storageInfo := map[string]int64{nodeAnnotationUsed: usedAnno.Value(), nodeAnnotationTotal: totalAnno.Value()}
+
+	// inode 统计为可选项，旧版本 enforcer 不会上报
+	inodesTotal, totalErr := resource.ParseQuantity(node.Annotations[nodeInodesTotal])
+	inodesUsed, usedErr := resource.ParseQuantity(node.Annotations[nodeInodesUsed])
+	if totalErr == nil && usedErr == nil {
+		storageInfo[nodeInodesTotal] = inodesTotal.Value()
+		storageInfo[nodeInodesUsed] = inodesUsed.Value()
+	}
 	p.statsCache.Store(node.Name, storageInfo)
 }
 
 func (p *TerminusSchedulerPlugin) handleNodeDelete(obj interface{}) {
 	if node, ok := obj.(*v1.Node); ok {
 		p.statsCache.Delete(node.Name)
+		p.assumed.removeNode(node.Name)
 	}
 }
 
@@ -121,67 +143,103 @@ func (p *TerminusSchedulerPlugin) Filter(ctx context.Context, state *schdulerFra
 	_, totalanno := node.Annotations[nodeAnnotationTotal]
 	_, useanno := node.Annotations[nodeAnnotationUsed]
 
-	if !totalanno || !useanno {
-		return schdulerFramework.NewStatus(schdulerFramework.Unschedulable,
-			fmt.Sprintf("%s not have annotation , matbe not open quota feaure, please check , skip this....", node.Name))
-	}
-
-	requestBytes := utils.GetPodTotalStorage(pod)
+	s := p.preFilterState(state, pod)
+	requestBytes := s.demand.bytes
 	val, ok := p.statsCache.Load(node.Name)
-	if !ok {
-		return schdulerFramework.NewStatus(schdulerFramework.Unschedulable, "Node storage stats missing")
+	if !totalanno || !useanno || !ok {
+		return p.filterUnannotated(pod, node.Name, s.demand)
 	}
 	stats := val.(map[string]int64)
 
 	//计算剩余空间 (支持超卖)
 	capacity := stats[nodeAnnotationTotal]
-	free := capacity - stats[nodeAnnotationUsed]
 	overCommit := int64(float64(capacity) * p.args.OversubscriptionRatio)
-	var nodeExistingAllocated int64 = 0
-
-	for _, podInfo := range nodeInfo.Pods {
-		nodeExistingAllocated += utils.GetPodTotalStorage(podInfo.Pod)
-	}
+	committed := p.nodeCommitted(s, node.Name)
+	nodeExistingAllocated := committed.bytes
 
 	if (nodeExistingAllocated + requestBytes) >= overCommit {
 		return schdulerFramework.NewStatus(schdulerFramework.Unschedulable,
 			fmt.Sprintf("Insufficient  storage: req %d, free %d", requestBytes, overCommit-nodeExistingAllocated))
 	}
 
+	if status := p.filterInodes(s.demand.inodes, committed.inodes, stats); status != nil {
+		return status
+	}
+
+	// 计入上次上报后已 Reserve 的用量
+	used := stats[nodeAnnotationUsed] + p.assumed.bytes(node.Name)
 	safeLimit := int64(float64(capacity) * threshold)
 
-	if stats[nodeAnnotationUsed] > safeLimit {
+	if used > safeLimit {
 		return schdulerFramework.NewStatus(schdulerFramework.Unschedulable,
 			fmt.Sprintf("Insufficient Physical storage: used %d > limit %d (95%%)",
-				requestBytes, free))
+				used, safeLimit))
 	}
 
 	klog.V(4).Infof("%s pod schedule node %s ", pod.Name, node.Name)
 	return nil
 }
 
+// filterUnannotated 按 UnannotatedNodePolicy 处理没有 Terminus 存储统计的节点，
+// 这类节点无法通过抢占变为可调度，返回 UnschedulableAndUnresolvable
+func (p *TerminusSchedulerPlugin) filterUnannotated(pod *v1.Pod, nodeName string, demand podUsage) *schdulerFramework.Status {
+	switch p.args.UnannotatedNodePolicy {
+	case UnannotatedNodeAllow:
+		return nil
+	case UnannotatedNodeAllowIfNoDemand:
+		if demand == (podUsage{}) {
+			return nil
+		}
+		return schdulerFramework.NewStatus(schdulerFramework.UnschedulableAndUnresolvable,
+			fmt.Sprintf("node %s has no Terminus storage stats and pod %s requests storage", nodeName, pod.Name))
+	default:
+		return schdulerFramework.NewStatus(schdulerFramework.UnschedulableAndUnresolvable,
+			fmt.Sprintf("node %s has no Terminus storage stats, maybe the enforcer is not running on it", nodeName))
+	}
+}
+
+// filterInodes 校验节点的 inode 预算，节点未上报 inode 统计或 Pod 未声明 inode 限额时跳过
+func (p *TerminusSchedulerPlugin) filterInodes(requestInodes, existingInodes int64, stats map[string]int64) *schdulerFramework.Status {
+	if requestInodes == 0 {
+		return nil
+	}
+
+	inodesTotal, ok := stats[nodeInodesTotal]
+	if !ok || inodesTotal == 0 {
+		return nil
+	}
+
+	overCommit := int64(float64(inodesTotal) * p.args.OversubscriptionRatio)
+
+	if (existingInodes + requestInodes) >= overCommit {
+		return schdulerFramework.NewStatus(schdulerFramework.Unschedulable,
+			fmt.Sprintf("Insufficient inodes: req %d, free %d", requestInodes, overCommit-existingInodes))
+	}
+
+	if stats[nodeInodesUsed] > int64(float64(inodesTotal)*threshold) {
+		return schdulerFramework.NewStatus(schdulerFramework.Unschedulable,
+			fmt.Sprintf("Insufficient Physical inodes: used %d > limit %d (95%%)",
+				stats[nodeInodesUsed], int64(float64(inodesTotal)*threshold)))
+	}
+
+	return nil
+}
+
 // Score: 剩余空间越大的节点，分数越高 (LeastAllocated 策略)
 func (p *TerminusSchedulerPlugin) Score(ctx context.Context, state *schdulerFramework.CycleState, pod *v1.Pod, nodeName string) (int64, *schdulerFramework.Status) {
-	nodeInfo, err := p.handle.SnapshotSharedLister().NodeInfos().Get(nodeName)
-	if err != nil {
-		return 0, nil
-	}
-	val, ok := p.statsCache.Load(nodeInfo.Node().Name)
+	val, ok := p.statsCache.Load(nodeName)
 	if !ok {
-		return 0, nil
+		// 没有存储统计的节点只有在 UnannotatedNodePolicy 允许时才会通过 Filter，给中间分，不偏向也不排斥
+		return schdulerFramework.MaxNodeScore / 2, nil
 	}
 
 	stats := val.(map[string]int64)
 	capacity := stats[nodeAnnotationTotal]
-	free := capacity - stats[nodeAnnotationUsed]
+	free := capacity - stats[nodeAnnotationUsed] - p.assumed.bytes(nodeName)
 	overCommit := int64(float64(capacity) * p.args.OversubscriptionRatio)
-	podRequest := utils.GetPodTotalStorage(pod)
-
-	var existingAllocated int64 = 0
-
-	for _, podInfo := range nodeInfo.Pods {
-		existingAllocated += utils.GetPodTotalStorage(podInfo.Pod)
-	}
+	s := p.preFilterState(state, pod)
+	podRequest := s.demand.bytes
+	existingAllocated := p.nodeCommitted(s, nodeName).bytes
 
 	logicalFree := overCommit - (existingAllocated + podRequest)
 
@@ -193,9 +251,7 @@ func (p *TerminusSchedulerPlugin) Score(ctx context.Context, state *schdulerFram
 
 	score := min(logicalScore, physicalScore)
 
-	p.scoreLock.RLock()
-	aiScore, exists := p.aiScores[nodeName]
-	p.scoreLock.RUnlock()
+	aiScore, exists := p.aiScore(state, nodeName)
 
 	if !exists {
 		klog.V(4).Infof("%s pod, node %s score is : %v ", pod.Name, nodeName, score)
@@ -207,4 +263,9 @@ func (p *TerminusSchedulerPlugin) Score(ctx context.Context, state *schdulerFram
 	return finalScore, nil
 }
 
-func (p *TerminusSchedulerPlugin) ScoreExtensions() schdulerFramework.ScoreExtensions { return nil }
+func (p *TerminusSchedulerPlugin) ScoreExtensions() schdulerFramework.ScoreExtensions { return p }
+
+// NormalizeScore 将可调度节点的最终分数按最高分缩放到 [0, MaxNodeScore]
+func (p *TerminusSchedulerPlugin) NormalizeScore(ctx context.Context, state *schdulerFramework.CycleState, pod *v1.Pod, scores schdulerFramework.NodeScoreList) *schdulerFramework.Status {
+	return helper.DefaultNormalizeScore(schdulerFramework.MaxNodeScore, false, scores)
+}
@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	schdulerFramework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+const (
+	preFilterStateKey = "PreFilter" + SchedulerName
+	preScoreStateKey  = "PreScore" + SchedulerName
+)
+
+var _ schdulerFramework.PreFilterPlugin = &TerminusSchedulerPlugin{}
+var _ schdulerFramework.PreScorePlugin = &TerminusSchedulerPlugin{}
+
+// preFilterState 为单次调度周期内 Pod 的限额，只计算一次
+type preFilterState struct {
+	demand podUsage
+	// adjust 为抢占与提名 Pod 模拟中对节点已分配限额的修正，committedIndex 中没有这部分变化
+	adjust map[string]podUsage
+}
+
+func (s *preFilterState) Clone() schdulerFramework.StateData {
+	adjust := make(map[string]podUsage, len(s.adjust))
+	for node, usage := range s.adjust {
+		adjust[node] = usage
+	}
+	return &preFilterState{demand: s.demand, adjust: adjust}
+}
+
+// preScoreState 为本周期使用的 AI 评分快照，避免每个节点都加锁
+type preScoreState struct {
+	aiScores map[string]int64
+}
+
+func (s *preScoreState) Clone() schdulerFramework.StateData { return s }
+
+// PreFilter 计算 Pod 的磁盘与 inode 限额并写入 CycleState
+func (p *TerminusSchedulerPlugin) PreFilter(ctx context.Context, state *schdulerFramework.CycleState, pod *v1.Pod) (*schdulerFramework.PreFilterResult, *schdulerFramework.Status) {
+	state.Write(preFilterStateKey, &preFilterState{demand: podDemand(pod), adjust: make(map[string]podUsage)})
+	return nil, nil
+}
+
+func (p *TerminusSchedulerPlugin) PreFilterExtensions() schdulerFramework.PreFilterExtensions {
+	return p
+}
+
+// AddPod 在抢占与提名 Pod 模拟中将 Pod 计入节点
+func (p *TerminusSchedulerPlugin) AddPod(ctx context.Context, state *schdulerFramework.CycleState, podToSchedule *v1.Pod, podInfoToAdd *schdulerFramework.PodInfo, nodeInfo *schdulerFramework.NodeInfo) *schdulerFramework.Status {
+	s := p.preFilterState(state, podToSchedule)
+	usage := s.adjust[nodeInfo.Node().Name]
+	usage.add(podDemand(podInfoToAdd.Pod))
+	s.adjust[nodeInfo.Node().Name] = usage
+	return nil
+}
+
+// RemovePod 在抢占模拟中将被驱逐的 Pod 从节点移除
+func (p *TerminusSchedulerPlugin) RemovePod(ctx context.Context, state *schdulerFramework.CycleState, podToSchedule *v1.Pod, podInfoToRemove *schdulerFramework.PodInfo, nodeInfo *schdulerFramework.NodeInfo) *schdulerFramework.Status {
+	s := p.preFilterState(state, podToSchedule)
+	usage := s.adjust[nodeInfo.Node().Name]
+	usage.sub(podDemand(podInfoToRemove.Pod))
+	s.adjust[nodeInfo.Node().Name] = usage
+	return nil
+}
+
+// preFilterState 读取 CycleState，profile 未启用 preFilter 时现场计算
+func (p *TerminusSchedulerPlugin) preFilterState(state *schdulerFramework.CycleState, pod *v1.Pod) *preFilterState {
+	if data, err := state.Read(preFilterStateKey); err == nil {
+		if s, ok := data.(*preFilterState); ok {
+			return s
+		}
+	}
+
+	s := &preFilterState{demand: podDemand(pod), adjust: make(map[string]podUsage)}
+	state.Write(preFilterStateKey, s)
+	return s
+}
+
+// nodeCommitted 返回节点上已分配的限额，包含本周期模拟的修正
+func (p *TerminusSchedulerPlugin) nodeCommitted(s *preFilterState, nodeName string) podUsage {
+	usage := p.committed.get(nodeName)
+	usage.add(s.adjust[nodeName])
+	return usage
+}
+
+// PreScore 复制本周期可调度节点的 AI 评分
+func (p *TerminusSchedulerPlugin) PreScore(ctx context.Context, state *schdulerFramework.CycleState, pod *v1.Pod, nodes []*schdulerFramework.NodeInfo) *schdulerFramework.Status {
+	s := &preScoreState{aiScores: make(map[string]int64)}
+
+	p.scoreLock.RLock()
+	if len(p.aiScores) > 0 {
+		for _, nodeInfo := range nodes {
+			if score, ok := p.aiScores[nodeInfo.Node().Name]; ok {
+				s.aiScores[nodeInfo.Node().Name] = score
+			}
+		}
+	}
+	p.scoreLock.RUnlock()
+
+	state.Write(preScoreStateKey, s)
+	return nil
+}
+
+// aiScore 返回节点的 AI 评分，优先使用 PreScore 的快照
+func (p *TerminusSchedulerPlugin) aiScore(state *schdulerFramework.CycleState, nodeName string) (int64, bool) {
+	if data, err := state.Read(preScoreStateKey); err == nil {
+		if s, ok := data.(*preScoreState); ok {
+			score, exists := s.aiScores[nodeName]
+			return score, exists
+		}
+	}
+
+	p.scoreLock.RLock()
+	defer p.scoreLock.RUnlock()
+	score, exists := p.aiScores[nodeName]
+	return score, exists
+}
@@ -6,23 +6,72 @@ import (
 )
 
 const (
-	KeyGlobalDefault = "storage.terminus.io/size"
-	PrefixSpecific   = "storage.terminus.io/size."
+	KeyGlobalDefault      = "storage.terminus.io/size"
+	PrefixSpecific        = "storage.terminus.io/size."
+	KeyInodeGlobalDefault = "storage.terminus.io/inodes"
+	PrefixInodeSpecific   = "storage.terminus.io/inodes."
+	KeyPodSize            = "storage.terminus.io/pod-size"
 )
 
-func GetPodTotalStorage(pod *v1.Pod) int64 {
-	var total int64 = 0
-
-	for _, c := range pod.Spec.Containers {
-		total += GetContainerQuota(pod.Annotations, c.Name)
+// GetPodStorageDemand 计算 Pod 对节点磁盘的需求，注入 webhook 未生效时从原生字段推导。
+// 容器依次取限额 annotation、ephemeral-storage limit、request，按 Kubernetes 有效请求合并 init 容器与 sidecar，
+// 再加上磁盘型 emptyDir 的 sizeLimit。设置了 Pod 级共享限额时直接返回该值，其中已包含 emptyDir
+func GetPodStorageDemand(pod *v1.Pod) int64 {
+	if val, ok := pod.Annotations[KeyPodSize]; ok {
+		return parseSize(val)
 	}
-	for _, c := range pod.Spec.InitContainers {
-		total += GetContainerQuota(pod.Annotations, c.Name)
+
+	total := effectiveRequest(pod, func(c *v1.Container) int64 {
+		return GetContainerStorage(pod.Annotations, c)
+	})
+
+	for _, volume := range pod.Spec.Volumes {
+		if volume.EmptyDir == nil || volume.EmptyDir.Medium == v1.StorageMediumMemory || volume.EmptyDir.SizeLimit == nil {
+			continue
+		}
+		total += volume.EmptyDir.SizeLimit.Value()
 	}
 
 	return total
 }
 
+// GetContainerStorage 返回容器可写层的磁盘需求，annotation 优先，其次为 ephemeral-storage limit 与 request
+func GetContainerStorage(annotations map[string]string, c *v1.Container) int64 {
+	if quota := GetContainerQuota(annotations, c.Name); quota > 0 {
+		return quota
+	}
+	if q, ok := c.Resources.Limits[v1.ResourceEphemeralStorage]; ok {
+		return q.Value()
+	}
+	if q, ok := c.Resources.Requests[v1.ResourceEphemeralStorage]; ok {
+		return q.Value()
+	}
+	return 0
+}
+
+// effectiveRequest 按 Kubernetes 有效请求语义合并容器需求：
+// 普通 init 容器依次运行，只取峰值；sidecar（restartPolicy 为 Always 的 init 容器）启动后持续运行，与之后的容器叠加
+func effectiveRequest(pod *v1.Pod, request func(c *v1.Container) int64) int64 {
+	var sidecars, initPeak int64
+	for i := range pod.Spec.InitContainers {
+		c := &pod.Spec.InitContainers[i]
+		value := request(c)
+		if c.RestartPolicy != nil && *c.RestartPolicy == v1.ContainerRestartPolicyAlways {
+			sidecars += value
+			initPeak = max(initPeak, sidecars)
+			continue
+		}
+		initPeak = max(initPeak, sidecars+value)
+	}
+
+	var regular int64
+	for i := range pod.Spec.Containers {
+		regular += request(&pod.Spec.Containers[i])
+	}
+
+	return max(initPeak, sidecars+regular)
+}
+
 func GetContainerQuota(annotations map[string]string, containerName string) int64 {
 
 	if val, ok := annotations[PrefixSpecific+containerName]; ok {
@@ -36,6 +85,27 @@ func GetContainerQuota(annotations map[string]string, containerName string) int6
 	return 0
 }
 
+// GetPodTotalInodes 计算 Pod 申请的 inode 数量，init 容器与 sidecar 按 Kubernetes 有效请求合并
+func GetPodTotalInodes(pod *v1.Pod) int64 {
+	return effectiveRequest(pod, func(c *v1.Container) int64 {
+		return GetContainerInodes(pod.Annotations, c.Name)
+	})
+}
+
+// GetContainerInodes 读取容器的 inode 硬限制，容器级 annotation 优先于 Pod 级
+func GetContainerInodes(annotations map[string]string, containerName string) int64 {
+
+	if val, ok := annotations[PrefixInodeSpecific+containerName]; ok {
+		return parseSize(val)
+	}
+
+	if val, ok := annotations[KeyInodeGlobalDefault]; ok {
+		return parseSize(val)
+	}
+
+	return 0
+}
+
 func parseSize(q string) int64 {
 	qty, err := resource.ParseQuantity(q)
 	if err != nil {
@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func sidecar(name string) v1.Container {
+	always := v1.ContainerRestartPolicyAlways
+	return v1.Container{Name: name, RestartPolicy: &always}
+}
+
+func TestEffectiveRequest(t *testing.T) {
+	requests := map[string]int64{
+		"app": 10, "web": 20,
+		"init-small": 5, "init-big": 100,
+		"proxy": 3, "log": 7,
+	}
+
+	tests := []struct {
+		name string
+		spec v1.PodSpec
+		want int64
+	}{
+		{
+			name: "regular containers are summed",
+			spec: v1.PodSpec{Containers: []v1.Container{{Name: "app"}, {Name: "web"}}},
+			want: 30,
+		},
+		{
+			name: "init containers only count their peak",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{{Name: "init-small"}, {Name: "init-small"}},
+				Containers:     []v1.Container{{Name: "app"}},
+			},
+			want: 10,
+		},
+		{
+			name: "init peak above regular containers wins",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{{Name: "init-big"}},
+				Containers:     []v1.Container{{Name: "app"}, {Name: "web"}},
+			},
+			want: 100,
+		},
+		{
+			name: "sidecars add to regular containers",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{sidecar("proxy"), sidecar("log")},
+				Containers:     []v1.Container{{Name: "app"}},
+			},
+			want: 20,
+		},
+		{
+			name: "init container after a sidecar runs alongside it",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{sidecar("proxy"), {Name: "init-big"}},
+				Containers:     []v1.Container{{Name: "app"}},
+			},
+			want: 103,
+		},
+		{
+			name: "init container before a sidecar does not",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{{Name: "init-big"}, sidecar("proxy")},
+				Containers:     []v1.Container{{Name: "app"}},
+			},
+			want: 100,
+		},
+		{
+			name: "empty pod",
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &v1.Pod{Spec: tt.spec}
+			got := effectiveRequest(pod, func(c *v1.Container) int64 { return requests[c.Name] })
+			if got != tt.want {
+				t.Errorf("effectiveRequest() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPodStorageDemand(t *testing.T) {
+	gi := resource.MustParse("1Gi")
+	memory := v1.Volume{Name: "shm", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{Medium: v1.StorageMediumMemory, SizeLimit: &gi}}}
+	disk := v1.Volume{Name: "cache", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{SizeLimit: &gi}}}
+	unbounded := v1.Volume{Name: "tmp", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}
+
+	withStorage := func(name, limit, request string) v1.Container {
+		c := v1.Container{Name: name, Resources: v1.ResourceRequirements{Limits: v1.ResourceList{}, Requests: v1.ResourceList{}}}
+		if limit != "" {
+			c.Resources.Limits[v1.ResourceEphemeralStorage] = resource.MustParse(limit)
+		}
+		if request != "" {
+			c.Resources.Requests[v1.ResourceEphemeralStorage] = resource.MustParse(request)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		spec        v1.PodSpec
+		want        int64
+	}{
+		{
+			name:        "pod size overrides everything",
+			annotations: map[string]string{KeyPodSize: "5Gi", KeyGlobalDefault: "1Gi"},
+			spec:        v1.PodSpec{Containers: []v1.Container{{Name: "app"}}, Volumes: []v1.Volume{disk}},
+			want:        5 << 30,
+		},
+		{
+			name:        "container annotation beats the pod-wide default",
+			annotations: map[string]string{KeyGlobalDefault: "1Gi", PrefixSpecific + "app": "2Gi"},
+			spec:        v1.PodSpec{Containers: []v1.Container{{Name: "app"}, {Name: "web"}}},
+			want:        3 << 30,
+		},
+		{
+			name:        "annotation beats ephemeral-storage limit",
+			annotations: map[string]string{PrefixSpecific + "app": "2Gi"},
+			spec:        v1.PodSpec{Containers: []v1.Container{withStorage("app", "4Gi", "")}},
+			want:        2 << 30,
+		},
+		{
+			name: "limit beats request",
+			spec: v1.PodSpec{Containers: []v1.Container{withStorage("app", "4Gi", "1Gi")}},
+			want: 4 << 30,
+		},
+		{
+			name: "request without limit",
+			spec: v1.PodSpec{Containers: []v1.Container{withStorage("app", "", "1Gi")}},
+			want: 1 << 30,
+		},
+		{
+			name: "only disk emptyDirs with a sizeLimit are added",
+			spec: v1.PodSpec{Containers: []v1.Container{withStorage("app", "1Gi", "")}, Volumes: []v1.Volume{memory, disk, unbounded}},
+			want: 2 << 30,
+		},
+		{
+			name: "init containers and sidecars follow effective request",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{withStorage("migrate", "8Gi", ""), func() v1.Container {
+					c := withStorage("proxy", "1Gi", "")
+					c.RestartPolicy = sidecar("").RestartPolicy
+					return c
+				}()},
+				Containers: []v1.Container{withStorage("app", "2Gi", "")},
+			},
+			want: 8 << 30,
+		},
+		{
+			name:        "unparsable annotation falls back to nothing",
+			annotations: map[string]string{PrefixSpecific + "app": "lots"},
+			spec:        v1.PodSpec{Containers: []v1.Container{withStorage("app", "1Gi", "")}},
+			want:        1 << 30,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &v1.Pod{Spec: tt.spec}
+			pod.Annotations = tt.annotations
+			if got := GetPodStorageDemand(pod); got != tt.want {
+				t.Errorf("GetPodStorageDemand() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPodTotalInodes(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		spec        v1.PodSpec
+		want        int64
+	}{
+		{
+			name:        "pod-wide default applies to every container",
+			annotations: map[string]string{KeyInodeGlobalDefault: "1000"},
+			spec:        v1.PodSpec{Containers: []v1.Container{{Name: "app"}, {Name: "web"}}},
+			want:        2000,
+		},
+		{
+			name:        "container annotation beats the default",
+			annotations: map[string]string{KeyInodeGlobalDefault: "1000", PrefixInodeSpecific + "web": "5000"},
+			spec:        v1.PodSpec{Containers: []v1.Container{{Name: "app"}, {Name: "web"}}},
+			want:        6000,
+		},
+		{
+			name:        "init container peak",
+			annotations: map[string]string{PrefixInodeSpecific + "init": "50000", PrefixInodeSpecific + "app": "1000"},
+			spec:        v1.PodSpec{InitContainers: []v1.Container{{Name: "init"}}, Containers: []v1.Container{{Name: "app"}}},
+			want:        50000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &v1.Pod{Spec: tt.spec}
+			pod.Annotations = tt.annotations
+			if got := GetPodTotalInodes(pod); got != tt.want {
+				t.Errorf("GetPodTotalInodes() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
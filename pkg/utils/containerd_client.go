@@ -2,10 +2,15 @@ package utils
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/containerd/containerd/v2/client"
 	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/containerd/v2/defaults"
 	"k8s.io/klog/v2"
 )
 
@@ -99,6 +104,141 @@ func (w *ContainerdClientWrapper) LoadContainer(ctx context.Context, id string)
 	return cont, nil
 }
 
+// Containers 列出命名空间下的所有容器
+func (w *ContainerdClientWrapper) Containers(ctx context.Context) ([]client.Container, error) {
+	c, err := w.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := c.Containers(ctx)
+	if err != nil {
+		klog.Warningf("Failed to list containers, attempting to reconnect: %v", err)
+
+		if reconnectErr := w.reconnect(ctx); reconnectErr != nil {
+			return nil, err
+		}
+
+		c, err = w.getClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return c.Containers(ctx)
+	}
+
+	return containers, nil
+}
+
+// WritableLayer 描述容器 snapshot 的可写层，ProjectID 取自 overlay snapshot ID
+type WritableLayer struct {
+	ProjectID uint32
+	UpperDir  string
+	WorkDir   string
+}
+
+// ResolveWritableLayer 从 snapshot 中解析容器的 upperdir/workdir。
+// CreateContainer 阶段容器尚未持久化，此时以容器 ID 作为 snapshot key，snapshotter 取自同一 sandbox，
+// sandboxID 为空或 sandbox 不可用时按 containerd 的规则取命名空间默认值
+func (w *ContainerdClientWrapper) ResolveWritableLayer(ctx context.Context, containerID, sandboxID string) (*WritableLayer, error) {
+	snapshotKey := containerID
+	snapshotterName := ""
+
+	if cont, err := w.LoadContainer(ctx, containerID); err == nil {
+		if info, err := cont.Info(ctx); err == nil {
+			if info.SnapshotKey != "" {
+				snapshotKey = info.SnapshotKey
+			}
+			snapshotterName = info.Snapshotter
+		}
+	}
+
+	if snapshotterName == "" {
+		name, err := w.defaultSnapshotter(ctx, sandboxID)
+		if err != nil {
+			return nil, err
+		}
+		snapshotterName = name
+	}
+
+	snapshotter := w.SnapshotService(snapshotterName)
+	if snapshotter == nil {
+		return nil, fmt.Errorf("snapshotter %s not found", snapshotterName)
+	}
+
+	mounts, err := snapshotter.Mounts(ctx, snapshotKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mounts for snapshot %s: %w", snapshotKey, err)
+	}
+
+	for _, m := range mounts {
+		upperdir := findOptionValue(m.Options, "upperdir")
+		workdir := findOptionValue(m.Options, "workdir")
+
+		// 没有父层的 snapshot 会以 bind 方式挂载 fs 目录
+		if upperdir == "" && m.Type == "bind" {
+			upperdir = m.Source
+			workdir = filepath.Join(filepath.Dir(m.Source), "work")
+		}
+
+		if upperdir == "" {
+			continue
+		}
+
+		klog.V(4).Infof("Writable upperdir: %s, workdir: %s", upperdir, workdir)
+
+		snapshotIDStr := filepath.Base(filepath.Dir(upperdir))
+		snapshotID, err := strconv.ParseUint(snapshotIDStr, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse snapshot ID %q: %v", snapshotIDStr, err)
+		}
+
+		return &WritableLayer{
+			ProjectID: uint32(snapshotID),
+			UpperDir:  upperdir,
+			WorkDir:   workdir,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("no writable layer found for snapshot %s", snapshotKey)
+}
+
+// defaultSnapshotter 返回尚未持久化的容器将使用的 snapshotter。
+// 同一 sandbox 的容器由同一 runtime handler 创建，优先使用 sandbox 容器的 snapshotter，
+// 其次为命名空间上 containerd.io/defaults/snapshotter 配置的值，最后为 containerd 的平台默认值
+func (w *ContainerdClientWrapper) defaultSnapshotter(ctx context.Context, sandboxID string) (string, error) {
+	if sandboxID != "" {
+		if sandbox, err := w.LoadContainer(ctx, sandboxID); err == nil {
+			if info, err := sandbox.Info(ctx); err == nil && info.Snapshotter != "" {
+				return info.Snapshotter, nil
+			}
+		}
+	}
+
+	c, err := w.getClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	label, err := c.GetLabel(ctx, defaults.DefaultSnapshotterNSLabel)
+	if err != nil {
+		return "", fmt.Errorf("failed to get default snapshotter of namespace: %w", err)
+	}
+	if label != "" {
+		return label, nil
+	}
+	return defaults.DefaultSnapshotter, nil
+}
+
+func findOptionValue(opts []string, key string) string {
+	prefix := key + "="
+	for _, opt := range opts {
+		if strings.HasPrefix(opt, prefix) {
+			return strings.TrimPrefix(opt, prefix)
+		}
+	}
+	return ""
+}
+
 func (w *ContainerdClientWrapper) SnapshotService(name string) snapshots.Snapshotter {
 	c, err := w.getClient(context.Background())
 	if err != nil {
@@ -11,6 +11,10 @@ type DiskStatus struct {
 	Free      uint64 // 剩余可用 (对非 root 用户)
 	Avail     uint64 // 剩余可用 (对 root 用户，通常和 Free 一样，但有些系统会保留部分给 root)
 	BlockSize uint64 // 块大小
+
+	InodesTotal uint64 // inode 总数
+	InodesUsed  uint64 // 已使用 inode
+	InodesFree  uint64 // 剩余 inode
 }
 
 // GetDiskUsage 获取指定目录所在磁盘/分区的空间使用情况
@@ -31,5 +35,21 @@ func GetDiskUsage(path string) (DiskStatus, error) {
 	ds.Used = ds.Total - ds.Free
 	ds.BlockSize = blockSize
 
+	ds.InodesTotal = fs.Files
+	ds.InodesFree = fs.Ffree
+	ds.InodesUsed = ds.InodesTotal - ds.InodesFree
+
 	return ds, nil
 }
+
+// SameFilesystem 判断两个目录是否位于同一文件系统，ProjectID 的限额只在单个文件系统内统计
+func SameFilesystem(a, b string) (bool, error) {
+	var sa, sb syscall.Stat_t
+	if err := syscall.Stat(a, &sa); err != nil {
+		return false, err
+	}
+	if err := syscall.Stat(b, &sb); err != nil {
+		return false, err
+	}
+	return sa.Dev == sb.Dev, nil
+}
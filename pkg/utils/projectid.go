@@ -0,0 +1,394 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/terminus-io/Terminus/pkg/metadata"
+	terminus_quota "github.com/terminus-io/quota"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// MaxProjectID 是 ListQuotas 扫描的上限，所有分区都必须落在该值之内
+	MaxProjectID = uint32(999999999)
+
+	emptyDirPodVolumeDir = "volumes/kubernetes.io~empty-dir"
+)
+
+var (
+	ErrProjectIDExhausted = errors.New("project ID pool exhausted")
+
+	// DefaultProjectIDRanges 将 overlay snapshot ID 与 emptyDir、Pod 级分配的 ID 分开，
+	// snapshot ID 由 containerd 自增分配，远小于 emptyDir 分区的起点
+	DefaultProjectIDRanges = map[metadata.STORAGE_TYPE]IDRange{
+		metadata.ROOTFS_TYPE:   {Start: 1, End: 899999999},
+		metadata.EMPTYDIR_TYPE: {Start: 900000000, End: 949999999},
+		metadata.POD_TYPE:      {Start: 950000000, End: MaxProjectID},
+	}
+)
+
+// IDRange 是闭区间 [Start, End]
+type IDRange struct {
+	Start uint32 `json:"start"`
+	End   uint32 `json:"end"`
+}
+
+func (r IDRange) Contains(id uint32) bool { return id >= r.Start && id <= r.End }
+
+// ParseIDRange 解析 "start-end" 格式的区间
+func ParseIDRange(s string) (IDRange, error) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return IDRange{}, fmt.Errorf("invalid project ID range %q, want start-end", s)
+	}
+	start, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 32)
+	if err != nil {
+		return IDRange{}, fmt.Errorf("invalid project ID range %q: %v", s, err)
+	}
+	end, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 32)
+	if err != nil {
+		return IDRange{}, fmt.Errorf("invalid project ID range %q: %v", s, err)
+	}
+	if start == 0 || start > end || uint32(end) > MaxProjectID {
+		return IDRange{}, fmt.Errorf("invalid project ID range %q, want 0 < start <= end <= %d", s, MaxProjectID)
+	}
+	return IDRange{Start: uint32(start), End: uint32(end)}, nil
+}
+
+// projectIDEntry 记录一个 ProjectID 的归属，Owner 为空表示启动时在磁盘上发现、归属未知
+type projectIDEntry struct {
+	StorageType metadata.STORAGE_TYPE `json:"storage_type"`
+	Owner       string                `json:"owner"`
+}
+
+// ProjectIDAllocator 为各类存储分配 ProjectID，状态持久化在节点上，
+// 保证同一个 ProjectID 不会同时属于两个存活的卷
+type ProjectIDAllocator struct {
+	mu        sync.Mutex
+	statePath string
+	ranges    map[metadata.STORAGE_TYPE]IDRange
+	used      map[uint32]projectIDEntry
+	owners    map[string]uint32
+	next      map[metadata.STORAGE_TYPE]uint32
+}
+
+func NewProjectIDAllocator(statePath string, ranges map[metadata.STORAGE_TYPE]IDRange) (*ProjectIDAllocator, error) {
+	for t, r := range ranges {
+		for other, o := range ranges {
+			if t != other && r.Start <= o.End && o.Start <= r.End {
+				return nil, fmt.Errorf("project ID range for %s overlaps %s", t, other)
+			}
+		}
+	}
+
+	a := &ProjectIDAllocator{
+		statePath: statePath,
+		ranges:    ranges,
+		used:      make(map[uint32]projectIDEntry),
+		owners:    make(map[string]uint32),
+		next:      make(map[metadata.STORAGE_TYPE]uint32),
+	}
+
+	if err := a.load(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Rebuild 根据磁盘上的真实状态补全已占用的 ProjectID：
+// 各挂载点上已有 quota 的 ID，以及 kubelet 目录下 emptyDir 上设置的 ID
+func (a *ProjectIDAllocator) Rebuild(containerdPath, kubeletPath string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, mountPoint := range []string{containerdPath, kubeletPath} {
+		quotaInfos, err := terminus_quota.ListQuotas(mountPoint, terminus_quota.ProjQuota, MaxProjectID)
+		if err != nil {
+			return fmt.Errorf("failed to list project quotas on %s: %w", mountPoint, err)
+		}
+		for _, r := range quotaInfos {
+			a.reserveLocked(r.ID)
+		}
+	}
+
+	volumeDirs, err := filepath.Glob(filepath.Join(kubeletPath, "pods", "*", emptyDirPodVolumeDir, "*"))
+	if err != nil {
+		return err
+	}
+	for _, dir := range volumeDirs {
+		id, err := terminus_quota.GetProjectID(dir)
+		if err != nil || id <= 0 {
+			continue
+		}
+		podUID := filepath.Base(filepath.Dir(filepath.Dir(filepath.Dir(dir))))
+		storageType, owner := metadata.EMPTYDIR_TYPE, EmptyDirOwner(podUID, filepath.Base(dir))
+		switch t, _ := a.storageTypeOf(uint32(id)); t {
+		case metadata.POD_TYPE:
+			storageType, owner = metadata.POD_TYPE, PodOwner(podUID)
+		case metadata.EMPTYDIR_TYPE:
+		default:
+			// 升级前的内存分配池（600000-700000）分配的 emptyDir ID 落在 rootfs 分区内，
+			// 会与之后的 snapshot ID 冲突，迁移到 emptyDir 分区
+			newID, err := a.migrateLocked(kubeletPath, dir, uint32(id), owner)
+			if err != nil {
+				klog.ErrorS(err, "Failed to migrate legacy emptyDir project ID, keeping it", "dir", dir, "projectID", id)
+				break
+			}
+			klog.InfoS("Migrated legacy emptyDir project ID", "dir", dir, "from", id, "to", newID)
+			continue
+		}
+		if entry, ok := a.used[uint32(id)]; ok && entry.Owner != "" && entry.Owner != owner {
+			klog.Warningf("Project ID %d is set on %s but recorded for %s", id, dir, entry.Owner)
+			continue
+		}
+		a.setLocked(uint32(id), storageType, owner)
+	}
+
+	klog.InfoS("Project ID allocator rebuilt", "used", len(a.used))
+	return a.saveLocked()
+}
+
+// Allocate 为 owner 分配一个指定类型分区内的 ProjectID，owner 已持有 ID 时直接返回该 ID
+func (a *ProjectIDAllocator) Allocate(storageType metadata.STORAGE_TYPE, owner string) (uint32, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if id, ok := a.owners[owner]; ok {
+		return id, nil
+	}
+
+	id, err := a.allocateLocked(storageType, owner)
+	if err != nil {
+		return 0, err
+	}
+	if err := a.saveLocked(); err != nil {
+		a.releaseLocked(id)
+		return 0, err
+	}
+	return id, nil
+}
+
+func (a *ProjectIDAllocator) allocateLocked(storageType metadata.STORAGE_TYPE, owner string) (uint32, error) {
+	r, ok := a.ranges[storageType]
+	if !ok {
+		return 0, fmt.Errorf("no project ID range configured for %s", storageType)
+	}
+
+	id := a.next[storageType]
+	if !r.Contains(id) {
+		id = r.Start
+	}
+
+	for i := uint64(0); i <= uint64(r.End-r.Start); i++ {
+		if _, taken := a.used[id]; !taken {
+			a.setLocked(id, storageType, owner)
+			a.next[storageType] = id + 1
+			return id, nil
+		}
+		if id == r.End {
+			id = r.Start
+		} else {
+			id++
+		}
+	}
+
+	return 0, ErrProjectIDExhausted
+}
+
+// migrateLocked 将 emptyDir 目录从 oldID 迁移到 emptyDir 分区内新分配的 ID，限额保持不变。
+// Pod 上的 emptydir.terminus.io/project-id annotation 在下一次容器启动时更新
+func (a *ProjectIDAllocator) migrateLocked(mountPoint, dir string, oldID uint32, owner string) (uint32, error) {
+	info, err := terminus_quota.GetQuota(mountPoint, oldID, terminus_quota.ProjQuota)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get quota of project ID %d: %w", oldID, err)
+	}
+
+	newID, err := a.allocateLocked(metadata.EMPTYDIR_TYPE, owner)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := terminus_quota.SetQuota(mountPoint, newID, terminus_quota.ProjQuota,
+		info.BlockHardLimit, info.BlockSoftLimit, info.InodeHardLimit, info.InodeSoftLimit); err != nil {
+		a.releaseLocked(newID)
+		return 0, fmt.Errorf("failed to set quota on project ID %d: %w", newID, err)
+	}
+	if err := terminus_quota.SetProjectIDRecursive(dir, int(newID)); err != nil {
+		_ = terminus_quota.RemoveQuota(mountPoint, newID, terminus_quota.ProjQuota)
+		a.releaseLocked(newID)
+		return 0, fmt.Errorf("failed to set project ID %d on %s: %w", newID, dir, err)
+	}
+
+	if err := terminus_quota.RemoveQuota(mountPoint, oldID, terminus_quota.ProjQuota); err != nil {
+		klog.ErrorS(err, "Failed to remove legacy emptyDir quota, GC will collect it", "projectID", oldID)
+	}
+	a.releaseLocked(oldID)
+	return newID, nil
+}
+
+// Claim 登记一个由外部决定的 ProjectID（例如 overlay snapshot ID），
+// 该 ID 已属于其他存活的卷时返回错误
+func (a *ProjectIDAllocator) Claim(storageType metadata.STORAGE_TYPE, id uint32, owner string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if r, ok := a.ranges[storageType]; ok && !r.Contains(id) {
+		return fmt.Errorf("project ID %d for %s is outside the %s range %d-%d", id, owner, storageType, r.Start, r.End)
+	}
+
+	if entry, ok := a.used[id]; ok && entry.Owner != "" && entry.Owner != owner {
+		return fmt.Errorf("project ID %d is already held by %s", id, entry.Owner)
+	}
+
+	if prev, ok := a.owners[owner]; ok && prev != id {
+		delete(a.used, prev)
+	}
+
+	a.setLocked(id, storageType, owner)
+	return a.saveLocked()
+}
+
+// Release 释放 ProjectID，之后可被再次分配
+func (a *ProjectIDAllocator) Release(id uint32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.used[id]; !ok {
+		return
+	}
+	a.releaseLocked(id)
+	if err := a.saveLocked(); err != nil {
+		klog.ErrorS(err, "Failed to persist project ID allocator state", "id", id)
+	}
+}
+
+// Owner 返回 ProjectID 的持有者
+func (a *ProjectIDAllocator) Owner(id uint32) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry, ok := a.used[id]
+	return entry.Owner, ok
+}
+
+// Lookup 返回 owner 当前持有的 ProjectID
+func (a *ProjectIDAllocator) Lookup(owner string) (uint32, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	id, ok := a.owners[owner]
+	return id, ok
+}
+
+// LookupPrefix 返回所有 owner 以 prefix 开头的 ProjectID
+func (a *ProjectIDAllocator) LookupPrefix(prefix string) map[string]uint32 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	result := make(map[string]uint32)
+	for owner, id := range a.owners {
+		if strings.HasPrefix(owner, prefix) {
+			result[owner] = id
+		}
+	}
+	return result
+}
+
+// EmptyDirOwner 返回 emptyDir 卷在分配器中的归属标识
+func EmptyDirOwner(podUID, volumeName string) string {
+	return podUID + "/" + volumeName
+}
+
+// PodOwner 返回 Pod 级共享 ProjectID 在分配器中的归属标识
+func PodOwner(podUID string) string {
+	return "pod:" + podUID
+}
+
+func (a *ProjectIDAllocator) storageTypeOf(id uint32) (metadata.STORAGE_TYPE, bool) {
+	for t, r := range a.ranges {
+		if r.Contains(id) {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// reserveLocked 标记磁盘上已存在的 ID，归属未知
+func (a *ProjectIDAllocator) reserveLocked(id uint32) {
+	if id == 0 {
+		return
+	}
+	if _, ok := a.used[id]; ok {
+		return
+	}
+	storageType, _ := a.storageTypeOf(id)
+	a.used[id] = projectIDEntry{StorageType: storageType}
+}
+
+func (a *ProjectIDAllocator) setLocked(id uint32, storageType metadata.STORAGE_TYPE, owner string) {
+	if entry, ok := a.used[id]; ok && entry.Owner != "" {
+		delete(a.owners, entry.Owner)
+	}
+	a.used[id] = projectIDEntry{StorageType: storageType, Owner: owner}
+	if owner != "" {
+		a.owners[owner] = id
+	}
+}
+
+func (a *ProjectIDAllocator) releaseLocked(id uint32) {
+	if entry, ok := a.used[id]; ok && entry.Owner != "" {
+		delete(a.owners, entry.Owner)
+	}
+	delete(a.used, id)
+}
+
+func (a *ProjectIDAllocator) load() error {
+	if a.statePath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(a.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read project ID state %s: %w", a.statePath, err)
+	}
+
+	state := make(map[uint32]projectIDEntry)
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to decode project ID state %s: %w", a.statePath, err)
+	}
+
+	for id, entry := range state {
+		a.setLocked(id, entry.StorageType, entry.Owner)
+	}
+	klog.InfoS("Loaded project ID allocator state", "path", a.statePath, "used", len(a.used))
+	return nil
+}
+
+// saveLocked 先写临时文件再 rename，避免进程崩溃时留下损坏的状态文件
+func (a *ProjectIDAllocator) saveLocked() error {
+	if a.statePath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(a.used)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.statePath), 0o755); err != nil {
+		return err
+	}
+
+	tmp := a.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write project ID state: %w", err)
+	}
+	return os.Rename(tmp, a.statePath)
+}
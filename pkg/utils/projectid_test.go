@@ -0,0 +1,260 @@
+package utils
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/terminus-io/Terminus/pkg/metadata"
+)
+
+func TestParseIDRange(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    IDRange
+		wantErr bool
+	}{
+		{in: "1-899999999", want: IDRange{Start: 1, End: 899999999}},
+		{in: " 900000000 - 949999999 ", want: IDRange{Start: 900000000, End: 949999999}},
+		{in: "5-5", want: IDRange{Start: 5, End: 5}},
+		{in: "0-10", wantErr: true},
+		{in: "10-5", wantErr: true},
+		{in: "1-1000000000", wantErr: true},
+		{in: "100", wantErr: true},
+		{in: "a-10", wantErr: true},
+		{in: "1--10", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseIDRange(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseIDRange(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseIDRange(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewProjectIDAllocatorRanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		ranges  map[metadata.STORAGE_TYPE]IDRange
+		wantErr bool
+	}{
+		{name: "defaults", ranges: DefaultProjectIDRanges},
+		{
+			name: "adjacent ranges",
+			ranges: map[metadata.STORAGE_TYPE]IDRange{
+				metadata.ROOTFS_TYPE:   {Start: 1, End: 10},
+				metadata.EMPTYDIR_TYPE: {Start: 11, End: 20},
+			},
+		},
+		{
+			name: "overlapping ranges",
+			ranges: map[metadata.STORAGE_TYPE]IDRange{
+				metadata.ROOTFS_TYPE:   {Start: 1, End: 10},
+				metadata.EMPTYDIR_TYPE: {Start: 10, End: 20},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewProjectIDAllocator("", tt.ranges)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewProjectIDAllocator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProjectIDAllocatorAllocate(t *testing.T) {
+	ranges := map[metadata.STORAGE_TYPE]IDRange{
+		metadata.ROOTFS_TYPE:   {Start: 1, End: 10},
+		metadata.EMPTYDIR_TYPE: {Start: 100, End: 102},
+		metadata.POD_TYPE:      {Start: 200, End: 200},
+	}
+
+	type step struct {
+		storageType metadata.STORAGE_TYPE
+		owner       string
+		release     uint32
+		want        uint32
+		wantErr     error
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "ids come from the storage type's range",
+			steps: []step{
+				{storageType: metadata.EMPTYDIR_TYPE, owner: "uid/cache", want: 100},
+				{storageType: metadata.POD_TYPE, owner: PodOwner("uid"), want: 200},
+				{storageType: metadata.EMPTYDIR_TYPE, owner: "uid/logs", want: 101},
+			},
+		},
+		{
+			name: "same owner gets the same id",
+			steps: []step{
+				{storageType: metadata.EMPTYDIR_TYPE, owner: "uid/cache", want: 100},
+				{storageType: metadata.EMPTYDIR_TYPE, owner: "uid/cache", want: 100},
+			},
+		},
+		{
+			name: "exhausted range",
+			steps: []step{
+				{storageType: metadata.POD_TYPE, owner: PodOwner("a"), want: 200},
+				{storageType: metadata.POD_TYPE, owner: PodOwner("b"), wantErr: ErrProjectIDExhausted},
+			},
+		},
+		{
+			name: "released ids are reused after wrapping",
+			steps: []step{
+				{storageType: metadata.EMPTYDIR_TYPE, owner: "a/v", want: 100},
+				{storageType: metadata.EMPTYDIR_TYPE, owner: "b/v", want: 101},
+				{storageType: metadata.EMPTYDIR_TYPE, owner: "c/v", want: 102},
+				{release: 101},
+				{storageType: metadata.EMPTYDIR_TYPE, owner: "d/v", want: 101},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewProjectIDAllocator("", ranges)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, s := range tt.steps {
+				if s.release != 0 {
+					a.Release(s.release)
+					continue
+				}
+				got, err := a.Allocate(s.storageType, s.owner)
+				if !errors.Is(err, s.wantErr) {
+					t.Fatalf("step %d: Allocate() error = %v, want %v", i, err, s.wantErr)
+				}
+				if err == nil && got != s.want {
+					t.Fatalf("step %d: Allocate() = %d, want %d", i, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestProjectIDAllocatorClaim(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      uint32
+		owner   string
+		wantErr bool
+	}{
+		{name: "free id in range", id: 5, owner: "container-b"},
+		{name: "id held by the same owner", id: 3, owner: "container-a"},
+		{name: "id held by another owner", id: 3, owner: "container-b", wantErr: true},
+		{name: "id outside the rootfs range", id: 900000000, owner: "container-b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewProjectIDAllocator("", DefaultProjectIDRanges)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := a.Claim(metadata.ROOTFS_TYPE, 3, "container-a"); err != nil {
+				t.Fatal(err)
+			}
+
+			err = a.Claim(metadata.ROOTFS_TYPE, tt.id, tt.owner)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Claim() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if owner, ok := a.Owner(tt.id); !ok || owner != tt.owner {
+				t.Errorf("Owner(%d) = %q, %v, want %q", tt.id, owner, ok, tt.owner)
+			}
+		})
+	}
+}
+
+func TestProjectIDAllocatorClaimMovesOwner(t *testing.T) {
+	a, err := NewProjectIDAllocator("", DefaultProjectIDRanges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Claim(metadata.ROOTFS_TYPE, 3, "container-a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Claim(metadata.ROOTFS_TYPE, 4, "container-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := a.Owner(3); ok {
+		t.Errorf("id 3 is still held after its owner claimed id 4")
+	}
+	if id, ok := a.Lookup("container-a"); !ok || id != 4 {
+		t.Errorf("Lookup(container-a) = %d, %v, want 4", id, ok)
+	}
+}
+
+func TestProjectIDAllocatorPersistence(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "terminus", "project-ids.json")
+
+	a, err := NewProjectIDAllocator(statePath, DefaultProjectIDRanges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emptyDirID, err := a.Allocate(metadata.EMPTYDIR_TYPE, EmptyDirOwner("uid", "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Claim(metadata.ROOTFS_TYPE, 42, "container-a"); err != nil {
+		t.Fatal(err)
+	}
+	released, err := a.Allocate(metadata.POD_TYPE, PodOwner("uid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Release(released)
+
+	b, err := NewProjectIDAllocator(statePath, DefaultProjectIDRanges)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		owner  string
+		wantID uint32
+		wantOK bool
+	}{
+		{owner: EmptyDirOwner("uid", "cache"), wantID: emptyDirID, wantOK: true},
+		{owner: "container-a", wantID: 42, wantOK: true},
+		{owner: PodOwner("uid")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.owner, func(t *testing.T) {
+			id, ok := b.Lookup(tt.owner)
+			if ok != tt.wantOK || id != tt.wantID {
+				t.Errorf("Lookup(%q) = %d, %v, want %d, %v", tt.owner, id, ok, tt.wantID, tt.wantOK)
+			}
+		})
+	}
+
+	// 重新加载后不会把已持有的 ID 分配给新的 owner
+	next, err := b.Allocate(metadata.EMPTYDIR_TYPE, EmptyDirOwner("uid", "logs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == emptyDirID {
+		t.Errorf("Allocate() reused persisted id %d", next)
+	}
+}